@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ALERT_INTERVAL = "30s"
+	ALERT_KEEP     = 1000 // events of history in memory
+
+	ALERT_INACTIVE = "inactive"
+	ALERT_PENDING  = "pending" // condition is true, but not for duration yet
+	ALERT_FIRING   = "firing"
+	ALERT_RESOLVED = "resolved" // status of event only
+)
+
+// value of rule metric from source such as host, mysql and redis
+type AlertSource func(rule *AlertRule) (float64, error)
+
+// notify alert event, such as webhook, log and redis channel
+type AlertSink interface {
+	Notify(event *AlertEvent) error
+}
+
+// current state of rule
+type AlertState struct {
+	Rule      *AlertRule `json:"rule"`
+	State     string     `json:"state"` // inactive, pending or firing
+	Value     float64    `json:"value"`
+	Since     time.Time  `json:"since,omitzero"` // condition is true since
+	FiredAt   time.Time  `json:"fired_at,omitzero"`
+	EvalAt    time.Time  `json:"eval_at,omitzero"`
+	Error     string     `json:"error,omitempty"` // error of the last evaluation
+	forDuring time.Duration
+}
+
+// event of state change to firing or resolved
+type AlertEvent struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"` // firing or resolved
+	Severity  string    `json:"severity"`
+	Source    string    `json:"source"`
+	Metric    string    `json:"metric"`
+	Op        string    `json:"op"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Time      time.Time `json:"time"`
+	FiredAt   time.Time `json:"fired_at"`
+	Message   string    `json:"message"`
+}
+
+// evaluate AlertConfig.Rules every interval against sources, notify sinks when
+// state of rule changes to firing or resolved.
+type AlertEngine struct {
+	Alertconfig *AlertConfig
+	Redis       *RedisHandler // client of redis sink
+	sources     map[string]AlertSource
+	sinks       []AlertSink
+	states      []*AlertState
+	history     []AlertEvent // ring buffer of Keep events
+	next        int
+	mutex       sync.RWMutex
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// r := app.Group("/alerts")
+func (p *AlertEngine) AddRouter(r fiber.Router) error {
+	log.Info("AlertEngine AddRouter")
+
+	r.Get("", p.alertsHandler)
+	r.Get("/", p.alertsHandler)
+	r.Get("/history", p.historyHandler)
+
+	return nil
+}
+
+// register source of rules, such as host or mysql
+func (p *AlertEngine) AddSource(name string, source AlertSource) {
+	if p.sources == nil {
+		p.sources = make(map[string]AlertSource)
+	}
+	p.sources[name] = source
+}
+
+// check rules and sinks, then evaluate every interval
+func (p *AlertEngine) Start() error {
+	if !p.Alertconfig.Enable {
+		log.Info("alert engine is disabled")
+		return nil
+	}
+	interval, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				log.Debug("alert engine stop")
+				return
+			}
+			p.evaluate()
+		}
+	}()
+	log.Infof("alert engine start, %d rules and %d sinks", len(p.states), len(p.sinks))
+
+	return nil
+}
+
+// check config, states of rules and sinks, return evaluate interval
+func (p *AlertEngine) load() (time.Duration, error) {
+	if p.Alertconfig.Interval == "" {
+		p.Alertconfig.Interval = ALERT_INTERVAL
+	}
+	interval, err := time.ParseDuration(p.Alertconfig.Interval)
+	if err != nil || interval < time.Second {
+		return 0, fmt.Errorf("invalid alert.interval [%s], should be 1s at least", p.Alertconfig.Interval)
+	}
+	if p.Alertconfig.Keep <= 0 {
+		p.Alertconfig.Keep = ALERT_KEEP
+	}
+
+	states := make([]*AlertState, 0, len(p.Alertconfig.Rules))
+	for i := range p.Alertconfig.Rules {
+		rule := &p.Alertconfig.Rules[i]
+		state, err := p.checkRule(rule)
+		if err != nil {
+			return 0, err
+		}
+		states = append(states, state)
+	}
+	sinks := make([]AlertSink, 0, len(p.Alertconfig.Sinks))
+	for _, config := range p.Alertconfig.Sinks {
+		sink, err := p.newSink(config)
+		if err != nil {
+			return 0, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	p.mutex.Lock()
+	p.states, p.sinks = states, sinks
+	p.history = make([]AlertEvent, 0, min(p.Alertconfig.Keep, 64))
+	p.next = 0
+	p.mutex.Unlock()
+
+	return interval, nil
+}
+
+func (p *AlertEngine) Stop() {
+	if p.done == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+	p.done = nil
+}
+
+func (p *AlertEngine) checkRule(rule *AlertRule) (*AlertState, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("alert rule of source '%s' metric '%s' has no name", rule.Source, rule.Metric)
+	}
+	if _, ok := p.sources[rule.Source]; !ok {
+		return nil, fmt.Errorf("unknown source '%s' of alert rule '%s'", rule.Source, rule.Name)
+	}
+	if rule.Metric == "" && rule.Query == "" {
+		return nil, fmt.Errorf("alert rule '%s' has neither metric nor query", rule.Name)
+	}
+	if _, err := compareAlert(rule.Op, 0, 0); err != nil {
+		return nil, fmt.Errorf("alert rule '%s': %v", rule.Name, err)
+	}
+	state := &AlertState{Rule: rule, State: ALERT_INACTIVE}
+	if rule.For != "" {
+		d, err := time.ParseDuration(rule.For)
+		if err != nil {
+			return nil, fmt.Errorf("parse for [%s] of alert rule '%s' failed: %v", rule.For, rule.Name, err)
+		}
+		state.forDuring = d
+	}
+	return state, nil
+}
+
+func (p *AlertEngine) newSink(config AlertSinkConfig) (AlertSink, error) {
+	switch config.Type {
+	case "log":
+		return &logSink{}, nil
+	case "webhook":
+		if config.Url == "" {
+			return nil, fmt.Errorf("url of webhook alert sink is empty")
+		}
+		timeout := 10 * time.Second
+		if config.Timeout > 0 {
+			timeout = time.Duration(config.Timeout) * time.Second
+		}
+		return &webhookSink{url: config.Url, client: &http.Client{Timeout: timeout}}, nil
+	case "redis":
+		if config.Channel == "" || p.Redis == nil {
+			return nil, fmt.Errorf("channel of redis alert sink is empty or redis is not configured")
+		}
+		return &redisSink{redis: p.Redis, channel: config.Channel}, nil
+	}
+	return nil, fmt.Errorf("unknown alert sink type '%s'", config.Type)
+}
+
+// evaluate all rules, error of source keeps state of rule
+func (p *AlertEngine) evaluate() {
+	p.mutex.RLock()
+	states := p.states
+	p.mutex.RUnlock()
+
+	for _, state := range states {
+		rule := state.Rule
+		value, err := p.sources[rule.Source](rule)
+		now := time.Now()
+
+		p.mutex.Lock()
+		state.EvalAt = now
+		if err != nil {
+			if state.Error != err.Error() { // log once of the same error
+				log.Warnf("evaluate alert rule '%s' failed: %v", rule.Name, err)
+			}
+			state.Error = err.Error()
+			p.mutex.Unlock()
+			continue
+		}
+		state.Error = ""
+		state.Value = value
+		matched, _ := compareAlert(rule.Op, value, rule.Threshold)
+
+		var event *AlertEvent
+		switch {
+		case matched && state.State == ALERT_INACTIVE:
+			state.State, state.Since = ALERT_PENDING, now
+			fallthrough
+		case matched && state.State == ALERT_PENDING:
+			if now.Sub(state.Since) >= state.forDuring {
+				state.State, state.FiredAt = ALERT_FIRING, now
+				event = newAlertEvent(state, ALERT_FIRING, now)
+			}
+		case !matched && state.State == ALERT_FIRING:
+			event = newAlertEvent(state, ALERT_RESOLVED, now)
+			state.State, state.Since, state.FiredAt = ALERT_INACTIVE, time.Time{}, time.Time{}
+		case !matched:
+			state.State, state.Since = ALERT_INACTIVE, time.Time{}
+		}
+		if event != nil {
+			p.addHistory(*event)
+		}
+		p.mutex.Unlock()
+
+		if event != nil {
+			p.notify(event)
+		}
+	}
+}
+
+func newAlertEvent(state *AlertState, status string, now time.Time) *AlertEvent {
+	rule := state.Rule
+	metric := rule.Metric
+	if metric == "" {
+		metric = rule.Query
+	}
+	return &AlertEvent{
+		Name:      rule.Name,
+		Status:    status,
+		Severity:  rule.Severity,
+		Source:    rule.Source,
+		Metric:    metric,
+		Op:        rule.Op,
+		Threshold: rule.Threshold,
+		Value:     state.Value,
+		Time:      now,
+		FiredAt:   state.FiredAt,
+		Message: fmt.Sprintf("[%s] %s: %s %s = %g %s %g", strings.ToUpper(status), rule.Name,
+			rule.Source, metric, state.Value, rule.Op, rule.Threshold),
+	}
+}
+
+// add event to ring buffer of history, should be locked by caller
+func (p *AlertEngine) addHistory(event AlertEvent) {
+	if len(p.history) < p.Alertconfig.Keep {
+		p.history = append(p.history, event)
+		return
+	}
+	p.history[p.next] = event
+	p.next = (p.next + 1) % len(p.history)
+}
+
+// notify all sinks, failure of one sink does not stop others
+func (p *AlertEngine) notify(event *AlertEvent) {
+	for _, sink := range p.sinks {
+		if err := sink.Notify(event); err != nil {
+			log.Errorf("notify alert '%s' %s by %T failed: %v", event.Name, event.Status, sink, err)
+		}
+	}
+}
+
+func compareAlert(op string, value, threshold float64) (bool, error) {
+	switch op {
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case "==":
+		return value == threshold, nil
+	case "!=":
+		return value != threshold, nil
+	}
+	return false, fmt.Errorf("invalid op '%s', should be >, >=, <, <=, == or !=", op)
+}
+
+// GET /alerts, current state of rules, ?state=firing|pending|inactive
+func (p *AlertEngine) alertsHandler(c fiber.Ctx) error {
+	filter := c.Query("state")
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	list := make([]AlertState, 0, len(p.states))
+	firing := 0
+	for _, state := range p.states {
+		if state.State == ALERT_FIRING {
+			firing++
+		}
+		if filter == "" || state.State == filter {
+			list = append(list, *state)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"enable": p.Alertconfig.Enable,
+		"firing": firing,
+		"alerts": list,
+	})
+}
+
+// GET /alerts/history?name=&n=100, events of firing and resolved, the latest first
+func (p *AlertEngine) historyHandler(c fiber.Ctx) error {
+	name := c.Query("name")
+	n := fiber.Query[int](c, "n", 100)
+	if n <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "n should be positive")
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	list := make([]AlertEvent, 0, min(n, len(p.history)))
+	for i := 0; i < len(p.history) && len(list) < n; i++ {
+		event := p.history[(p.next-1-i+2*len(p.history))%len(p.history)]
+		if name == "" || event.Name == name {
+			list = append(list, event)
+		}
+	}
+	return c.JSON(fiber.Map{"events": list})
+}
+
+type logSink struct{}
+
+func (s *logSink) Notify(event *AlertEvent) error {
+	if event.Status == ALERT_FIRING {
+		log.Warn("alert " + event.Message)
+	} else {
+		log.Info("alert " + event.Message)
+	}
+	return nil
+}
+
+// POST event as json to url
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Notify(event *AlertEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, fiber.MIMEApplicationJSON, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returns status %d", s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// PUBLISH event as json to channel
+type redisSink struct {
+	redis   *RedisHandler
+	channel string
+}
+
+func (s *redisSink) Notify(event *AlertEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.redis.publish(s.channel, string(b))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestCompareAlert(t *testing.T) {
+	tests := []struct {
+		op               string
+		value, threshold float64
+		want             bool
+	}{
+		{">", 91, 90, true},
+		{">", 90, 90, false},
+		{">=", 90, 90, true},
+		{">=", 89.9, 90, false},
+		{"<", 1, 2, true},
+		{"<", 2, 2, false},
+		{"<=", 2, 2, true},
+		{"<=", 3, 2, false},
+		{"==", 0, 0, true},
+		{"==", 1, 0, false},
+		{"!=", 1, 0, true},
+		{"!=", 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := compareAlert(tt.op, tt.value, tt.threshold)
+		if err != nil {
+			t.Errorf("compareAlert(%q, %g, %g) error: %v", tt.op, tt.value, tt.threshold, err)
+		} else if got != tt.want {
+			t.Errorf("compareAlert(%q, %g, %g) want %v, got %v", tt.op, tt.value, tt.threshold, tt.want, got)
+		}
+	}
+
+	for _, op := range []string{"", "=", "gt", "=>"} {
+		if _, err := compareAlert(op, 0, 0); err == nil {
+			t.Errorf("compareAlert(%q) should be invalid", op)
+		}
+	}
+}
+
+// engine of one rule 'disk' of source 'fake', whose value is set by test
+func newTestAlertEngine(t *testing.T, rule AlertRule, keep int) (*AlertEngine, *float64, *error) {
+	var value float64
+	var sourceErr error
+	p := &AlertEngine{Alertconfig: &AlertConfig{Enable: true, Keep: keep, Rules: []AlertRule{rule}}}
+	p.AddSource("fake", func(rule *AlertRule) (float64, error) { return value, sourceErr })
+	if _, err := p.load(); err != nil {
+		t.Fatalf("load alert engine error: %v", err)
+	}
+	return p, &value, &sourceErr
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	rule := AlertRule{Name: "disk", Source: "fake", Metric: "used", Op: ">", Threshold: 90, For: "5m"}
+	p, value, sourceErr := newTestAlertEngine(t, rule, 10)
+	state := p.states[0]
+
+	steps := []struct {
+		value   float64
+		since   time.Duration // move Since back before evaluate, to pass 'for'
+		err     error
+		state   string
+		history int
+	}{
+		{value: 50, state: ALERT_INACTIVE, history: 0},
+		{value: 95, state: ALERT_PENDING, history: 0},
+		{value: 96, state: ALERT_PENDING, history: 0},  // not for 5m yet
+		{value: 50, state: ALERT_INACTIVE, history: 0}, // pending is reset without event
+		{value: 95, state: ALERT_PENDING, history: 0},  // pending again
+		{value: 95, since: 6 * time.Minute, state: ALERT_FIRING, history: 1},
+		{value: 97, state: ALERT_FIRING, history: 1},               // firing is notified once
+		{err: fmt.Errorf("down"), state: ALERT_FIRING, history: 1}, // error keeps state
+		{value: 80, state: ALERT_INACTIVE, history: 2},             // resolved
+		{value: 80, state: ALERT_INACTIVE, history: 2},
+	}
+	for i, step := range steps {
+		*value, *sourceErr = step.value, step.err
+		if step.since > 0 {
+			state.Since = state.Since.Add(-step.since)
+		}
+		p.evaluate()
+		if state.State != step.state {
+			t.Fatalf("step %d want state %s, got %s", i, step.state, state.State)
+		}
+		if len(p.history) != step.history {
+			t.Fatalf("step %d want %d events, got %d", i, step.history, len(p.history))
+		}
+		if (step.err != nil) != (state.Error != "") {
+			t.Errorf("step %d want error %v, got '%s'", i, step.err, state.Error)
+		}
+	}
+
+	if p.history[0].Status != ALERT_FIRING || p.history[0].Value != 95 {
+		t.Errorf("first event should be firing of 95, got %+v", p.history[0])
+	}
+	if p.history[1].Status != ALERT_RESOLVED || p.history[1].Value != 80 || p.history[1].FiredAt.IsZero() {
+		t.Errorf("second event should be resolved of 80 with fired_at, got %+v", p.history[1])
+	}
+	if !state.Since.IsZero() || !state.FiredAt.IsZero() {
+		t.Errorf("since and fired_at should be reset after resolved, got %v %v", state.Since, state.FiredAt)
+	}
+}
+
+func TestAlertEvaluateWithoutFor(t *testing.T) {
+	rule := AlertRule{Name: "disk", Source: "fake", Metric: "used", Op: ">=", Threshold: 90}
+	p, value, _ := newTestAlertEngine(t, rule, 10)
+
+	*value = 90
+	p.evaluate()
+	if p.states[0].State != ALERT_FIRING || len(p.history) != 1 {
+		t.Fatalf("rule without for should fire at once, got %s and %d events", p.states[0].State, len(p.history))
+	}
+}
+
+func TestAlertHistory(t *testing.T) {
+	rule := AlertRule{Name: "disk", Source: "fake", Metric: "used", Op: ">", Threshold: 90}
+	p, value, _ := newTestAlertEngine(t, rule, 3)
+	app := fiber.New()
+	p.AddRouter(app.Group("/alerts"))
+
+	history := func(query string) []AlertEvent {
+		resp, err := app.Test(httptest.NewRequest("GET", "/alerts/history"+query, nil))
+		if err != nil {
+			t.Fatalf("GET /alerts/history%s error: %v", query, err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Events []AlertEvent `json:"events"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode /alerts/history%s error: %v", query, err)
+		}
+		return body.Events
+	}
+	values := func(events []AlertEvent) []float64 {
+		list := make([]float64, 0, len(events))
+		for _, e := range events {
+			list = append(list, e.Value)
+		}
+		return list
+	}
+
+	if events := history(""); len(events) != 0 {
+		t.Fatalf("history should be empty, got %v", events)
+	}
+
+	// events of firing 91, resolved 1, firing 92, resolved 2 ..., keep the latest 3
+	tests := []struct {
+		n    int
+		want []float64
+	}{
+		{1, []float64{91}},
+		{2, []float64{1, 91}},
+		{3, []float64{92, 1, 91}},
+		{4, []float64{2, 92, 1}}, // ring buffer is full, the oldest is dropped
+		{5, []float64{93, 2, 92}},
+		{7, []float64{94, 3, 93}},
+	}
+	round := 0
+	for _, tt := range tests {
+		for round < tt.n {
+			round++
+			if round%2 == 1 {
+				*value = 90 + float64(round/2+1)
+			} else {
+				*value = float64(round / 2)
+			}
+			p.evaluate()
+		}
+		got := values(history(""))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("after %d events want history %v, got %v", tt.n, tt.want, got)
+		}
+	}
+
+	if got := values(history("?n=2")); fmt.Sprint(got) != "[94 3]" {
+		t.Errorf("history n=2 want [94 3], got %v", got)
+	}
+	if got := history("?name=other"); len(got) != 0 {
+		t.Errorf("history of other rule should be empty, got %v", got)
+	}
+	resp, _ := app.Test(httptest.NewRequest("GET", "/alerts/history?n=0", nil))
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("history n=0 want status 400, got %d", resp.StatusCode)
+	}
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -29,6 +32,11 @@ type ApiServer struct {
 	pgHdl       *PgHandler
 	hardwareHdl *HardwareHandler
 	hostHdl     *HostHandler
+	schema      *SchemaTracker
+	sampler     *HostSampler
+	jobs        *JobManager
+	metrics     *Metrics
+	alerts      *AlertEngine
 
 	mycache *cache.Cache
 }
@@ -37,6 +45,10 @@ func (p *ApiServer) Start() error {
 	p.mycache = cache.New(5*time.Minute, 10*time.Minute)
 
 	log.Info("🚀 API server prepare...")
+	bodyLimit := 4 // default 4M of fiber
+	if p.Myconfig.BodyLimit > 0 {
+		bodyLimit = int(p.Myconfig.BodyLimit)
+	}
 	app := fiber.New(fiber.Config{
 		CaseSensitive: true,
 		StrictRouting: true,
@@ -47,38 +59,78 @@ func (p *ApiServer) Start() error {
 		WriteTimeout:  30 * time.Second,
 		ProxyHeader:   fiber.HeaderXForwardedFor,
 		UnescapePath:  false, // default false
+		BodyLimit:     bodyLimit * 1024 * 1024,
+		// body larger than BodyLimit is streamed for upload of minio object only, see bodyLimitMiddleware
+		StreamRequestBody: true,
 	})
 
+	// metrics of http requests are counted before other routes
+	metrics := Metrics{Cache: p.mycache}
+	p.metrics = &metrics
 	p.initRoute(app)
 
-	// add MysqlHandler
-	mysqlHdl := MysqlHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.MysqlConfig, Mycache: p.mycache}}
-	mysqlHdl.AddRouter(app.Group("/mysql"))
+	// add JobManager of background jobs
+	jobs := JobManager{}
+	jobs.AddRouter(app.Group("/jobs"))
 
-	// add MinioHandler
-	minioHdl := MinioHandler{Minioconfig: &p.Myconfig.MinioConfig}
+	// add MinioHandler, exports of database handlers can be uploaded to minio
+	minioHdl := MinioHandler{Minioconfig: &p.Myconfig.MinioConfig, Jobs: &jobs, Mycache: p.mycache}
 	minioHdl.AddRouter(app.Group("/minio"))
 
+	// add MysqlHandler
+	mysqlHdl := MysqlHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.MysqlConfig, Mycache: p.mycache, Minio: &minioHdl}}
+	mysqlHdl.AddRouter(app.Group("/mysql"))
+
 	// add RedisHandler
-	redisHdl := RedisHandler{Redisconfig: &p.Myconfig.RedisConfig}
+	redisHdl := RedisHandler{Redisconfig: &p.Myconfig.RedisConfig, Jobs: &jobs}
 	redisHdl.AddRouter(app.Group("/redis"))
 
 	// add ClickhouseHandler
-	ckHdl := ClickhouseHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.CkConfig, Mycache: p.mycache}}
+	ckHdl := ClickhouseHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.CkConfig, Mycache: p.mycache, Minio: &minioHdl}}
 	ckHdl.AddRouter(app.Group("/clickhouse"))
 
 	// add PgHandler
-	pgHdl := PgHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.PgConfig, Mycache: p.mycache}}
+	pgHdl := PgHandler{DbHandler: DbHandler{Dbconfig: &p.Myconfig.PgConfig, Mycache: p.mycache, Minio: &minioHdl}}
 	pgHdl.AddRouter(app.Group("/postgresql"))
 
+	// add SchemaTracker of database handlers
+	schema := SchemaTracker{Schemaconfig: &p.Myconfig.SchemaConfig}
+	schema.AddRouter(app.Group("/mysql/schema"), "mysql", mysqlHdl.schemaSnapshot)
+	schema.AddRouter(app.Group("/postgresql/schema"), "postgresql", pgHdl.schemaSnapshot)
+	schema.AddRouter(app.Group("/clickhouse/schema"), "clickhouse", ckHdl.schemaSnapshot)
+	if err := schema.Start(); err != nil {
+		log.Errorf("start schema tracker failed: %v", err)
+	}
+
 	// add HardwareHandler
 	hardwareHdl := HardwareHandler{Mycache: p.mycache}
 	hardwareHdl.AddRouter(app.Group("/hardware"))
 
-	// add HostHandler
-	hostHdl := HostHandler{Mycache: p.mycache}
+	// add HostHandler, with background sampler of host metrics
+	sampler := HostSampler{Samplerconfig: &p.Myconfig.SamplerConfig}
+	if err := sampler.Start(); err != nil {
+		log.Errorf("start host sampler failed: %v", err)
+	}
+	hostHdl := HostHandler{Mycache: p.mycache, Sampler: &sampler}
 	hostHdl.AddRouter(app.Group("/host"))
 
+	// pools of database and redis handlers, and host gauges of /metrics
+	metrics.Dbs = map[string]*DbHandler{"mysql": &mysqlHdl.DbHandler, "clickhouse": &ckHdl.DbHandler, "postgresql": &pgHdl.DbHandler}
+	metrics.Redis = &redisHdl
+	metrics.Sampler = &sampler
+
+	// add AlertEngine, rules of host and database health
+	alerts := AlertEngine{Alertconfig: &p.Myconfig.AlertConfig, Redis: &redisHdl}
+	alerts.AddSource("host", sampler.alertValue)
+	alerts.AddSource("mysql", mysqlHdl.alertValue)
+	alerts.AddSource("postgresql", pgHdl.alertValue)
+	alerts.AddSource("clickhouse", ckHdl.alertValue)
+	alerts.AddSource("redis", redisHdl.alertValue)
+	alerts.AddRouter(app.Group("/alerts"))
+	if err := alerts.Start(); err != nil {
+		log.Errorf("start alert engine failed: %v", err)
+	}
+
 	// data, _ := json.MarshalIndent(app.Stack(), "", "  ")
 	// log.Debug(string(data))
 	// data, _ = json.MarshalIndent(app.Config(), "", "  ")
@@ -92,6 +144,10 @@ func (p *ApiServer) Start() error {
 	p.pgHdl = &pgHdl
 	p.hardwareHdl = &hardwareHdl
 	p.hostHdl = &hostHdl
+	p.schema = &schema
+	p.sampler = &sampler
+	p.alerts = &alerts
+	p.jobs = &jobs
 
 	// use CertFile and CertKeyFile to listen https
 	// 正常时阻塞在这里
@@ -143,6 +199,14 @@ func (p *ApiServer) Stop() error {
 		err := p.app.ShutdownWithTimeout(1 * time.Second)
 		// err := p.app.Shutdown()
 		p.app = nil
+		p.schema.Stop()
+		p.schema = nil
+		p.alerts.Stop() // before sampler and clients of its sources
+		p.alerts = nil
+		p.sampler.Stop()
+		p.sampler = nil
+		p.jobs.Stop()
+		p.jobs = nil
 		p.mysqlHdl.Close()
 		p.mysqlHdl = nil
 		p.minioHdl = nil
@@ -164,7 +228,9 @@ func (p *ApiServer) initRoute(app *fiber.App) error {
 	// 	log.Trace("🥇 Any handler: " + c.Path())
 	// 	return c.Next()
 	// })
+	app.Use(p.metrics.middleware)
 	app.Use(p.authMiddleware)
+	app.Use(p.bodyLimitMiddleware)
 
 	// // Match all routes starting with /api
 	// app.Use("/api", func(c fiber.Ctx) error {
@@ -224,6 +290,7 @@ func (p *ApiServer) initRoute(app *fiber.App) error {
 		<a href="/meta/status">/meta/status</a><br>
 		<a href="/meta/version">/meta/version</a><br>
 		<a href="/meta/config">/meta/config</a><br>
+		<a href="/metrics">/metrics</a><br>
 		<h1>Sub modules</h1>
 		<a href="/mysql">/mysql</a><br>
 		<a href="/minio">/minio</a><br>
@@ -232,6 +299,7 @@ func (p *ApiServer) initRoute(app *fiber.App) error {
 		<a href="/postgresql">/postgresql</a><br>
 		<a href="/hardware">/hardware</a><br>
 		<a href="/host">/host</a><br>
+		<a href="/alerts">/alerts</a><br>
 		</body></html>`)
 	})
 	app.Get("/meta/status", func(c fiber.Ctx) error {
@@ -270,10 +338,8 @@ func (p *ApiServer) initRoute(app *fiber.App) error {
 		app.Get("/meta/healthz", adaptor.HTTPHandler(healthzHandler))
 	}
 
-	// Or extend your config for customization
-	// Assign the middleware to /metrics
-	// and change the Title to `MyService Metrics Page`
-	// app.Get("/metrics", monitor.New())
+	// Prometheus metrics of http, pools of database and redis, cache and host
+	app.Get("/metrics", p.metrics.metricsHandler)
 
 	return nil
 }
@@ -293,5 +359,73 @@ func (p *ApiServer) authMiddleware(c fiber.Ctx) error {
 	// claims := user.Claims.(jwt.MapClaims)
 	// log.Info(claims)
 
+	// request without token is anonymous, which can access read only api
+	token := c.Get("X-Api-Token")
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token != "" {
+		user := p.findUser(token)
+		if user == nil {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+		}
+		c.Locals("user", user.Name)
+		c.Locals("role", user.Role)
+	}
+
 	return c.Next()
 }
+
+func (p *ApiServer) findUser(token string) *AuthUser {
+	for i, user := range p.Myconfig.AuthConfig.Users {
+		if user.Token != "" && subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+			return &p.Myconfig.AuthConfig.Users[i]
+		}
+	}
+	return nil
+}
+
+// upload of minio object, whose body is streamed without BodyLimit
+var streamBodyPath = regexp.MustCompile(`^/minio/bucket/[^/]+/object/.`)
+
+// with StreamRequestBody, body larger than BodyLimit or chunked is not read by fasthttp,
+// and c.Body() reads all of it. body of requests except upload of minio object is limited here.
+func (p *ApiServer) bodyLimitMiddleware(c fiber.Ctx) error {
+	if !c.Request().IsBodyStream() || (c.Method() == fiber.MethodPut && streamBodyPath.MatchString(c.Path())) {
+		return c.Next()
+	}
+
+	limit := c.App().Config().BodyLimit
+	length := c.Request().Header.ContentLength()
+	if length > limit {
+		return fiber.ErrRequestEntityTooLarge
+	}
+	if length == -1 { // chunked body, read up to limit
+		b, err := io.ReadAll(io.LimitReader(c.Request().BodyStream(), int64(limit)+1))
+		if err != nil {
+			return err
+		}
+		if len(b) > limit {
+			return fiber.ErrRequestEntityTooLarge
+		}
+		c.Request().SetBody(b)
+	}
+	return c.Next()
+}
+
+// middleware of admin role only api, such as redis write operations
+func adminOnly(c fiber.Ctx) error {
+	if role, _ := c.Locals("role").(string); role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "admin role is required")
+	}
+	return c.Next()
+}
+
+// write audit log of write operations, user is set by auth middleware
+func auditLog(c fiber.Ctx, module, action, target string, detail interface{}) {
+	user, _ := c.Locals("user").(string)
+	if user == "" {
+		user = "anonymous"
+	}
+	utils.AuditLog(user, c.IP(), module, action, target, detail)
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 
@@ -36,6 +34,7 @@ func (p *ClickhouseHandler) AddRouter(r fiber.Router) error {
 	r.Get("/table/:table/ddl", p.ddlHandler)
 	// r.Get("/table/:table/indexes", p.indexesHandler)
 	r.Get("/table/:table/ddl", p.ddlHandler)
+	r.Post("/table/:table/import", adminOnly, p.importHandler) // 导入 xlsx|csv|ndjson
 	r.Get("/views", p.viewsHandler)
 	r.Get("/view/:table", p.viewHandler)
 	r.Get("/view/:table/columns", p.columnsHandler)
@@ -59,8 +58,12 @@ func (p *ClickhouseHandler) homeHandler(c fiber.Ctx) error {
 	c.WriteString(`<html><body><h1>Clickhouse Information</h1>
 	<a href="/clickhouse/tables?mime=json">tables</a><br>
 	<a href="/clickhouse/table/:table?mime=json">table/:table_name/[columns|ddl]</a><br>
+	POST /clickhouse/table/:table/import?mode=dryrun|commit 上传 xlsx|csv|ndjson 文件导入表（admin）<br>
+	<a href="/clickhouse/schema/history">schema/history</a><br>
+	<a href="/clickhouse/schema/diff">schema/diff?from=&to=</a><br>
 	<a href="/clickhouse/views?mime=json">views</a><br>
 	<a href="/clickhouse/view/:view?mime=json">view/:view_name/[columns|ddl]</a><br>
+	mime=excel 导出文件，加 dest=minio://bucket/prefix/ 上传到 minio 并返回预签名下载链接（admin）<br>
 	</body></html>`)
 	return nil
 }
@@ -109,15 +112,7 @@ func (p *ClickhouseHandler) tablesHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -174,15 +169,7 @@ func (p *ClickhouseHandler) tableHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -229,15 +216,7 @@ func (p *ClickhouseHandler) columnsHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -275,6 +254,63 @@ func (p *ClickhouseHandler) viewHandler(c fiber.Ctx) error {
 	return p.sqlHandler2Json(c, sqltext)
 }
 
+// POST /clickhouse/table/:table/import?mode=dryrun|commit
+func (p *ClickhouseHandler) importHandler(c fiber.Ctx) error {
+	table, _ := url.QueryUnescape(c.Params("table"))
+	columns, err := p.getColumns(table)
+	if err != nil {
+		return err
+	}
+	types, err := p.queryMap(`select name, type
+		from system.columns
+		where database = ? and table = ?`, p.opt.Auth.Database, table)
+	if err != nil {
+		return err
+	}
+
+	var columnArray []string
+	if columns != "" {
+		columnArray = strings.Split(columns, ",")
+	}
+	return p.importRows(c, clickhouseDialect, table, columnArray, types)
+}
+
+// capture schema of database for SchemaTracker
+func (p *ClickhouseHandler) schemaSnapshot() (*SchemaSnapshot, error) {
+	if p.opt == nil {
+		return nil, fmt.Errorf("%s %w", p.Dbconfig.Dbtype, errDsnInvalid)
+	}
+	tables, err := p.queryRows(`select name, engine
+		from system.tables
+		where database = ?
+		order by name`, p.opt.Auth.Database)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := p.queryRows(`select table, name, type, '', default_expression
+		from system.columns
+		where database = ?
+		order by table, position`, p.opt.Auth.Database)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := p.queryRows(`select table, name,
+			concat(expr, ' TYPE ', type, ' GRANULARITY ', toString(granularity))
+		from system.data_skipping_indices
+		where database = ?`, p.opt.Auth.Database)
+	if err != nil {
+		return nil, err
+	}
+	ddls, err := p.queryRows(`select name, create_table_query
+		from system.tables
+		where database = ?`, p.opt.Auth.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSnapshot(p.Dbconfig.Dbtype, p.opt.Auth.Database, tables, columns, indexes, ddls), nil
+}
+
 // get columns of table to string with ',' split
 func (p *ClickhouseHandler) getColumns(table string) (string, error) {
 	if p.db == nil {
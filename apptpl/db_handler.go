@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/gofiber/fiber/v3"
 	"github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
@@ -19,7 +22,8 @@ const (
 type DbHandler struct {
 	Dbconfig *DBConfig
 	Mycache  *cache.Cache
-	db       *sql.DB // dbpool
+	Minio    *MinioHandler // upload excel and docx exports to minio by query dest=minio://bucket/prefix/
+	db       *sql.DB       // dbpool
 }
 
 // write sql result from colums record to fiber response
@@ -188,15 +192,153 @@ func (p *DbHandler) sql2chan(ch chan string, sqltext string) error {
 	return nil
 }
 
+// query first column of every row to string slice, such as column names
+func (p *DbHandler) queryColumn(sqltext string, args ...interface{}) ([]string, error) {
+	log.Tracef("%s sql: %s, args: %v\n", p.Dbconfig.Dbtype, sqltext, args)
+	if p.db == nil {
+		if err := p.openDB(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := p.db.Query(sqltext, args...)
+	if err != nil {
+		log.Error("Error executing query:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]string, 0)
+	var value string
+	for rows.Next() {
+		err = rows.Scan(&value)
+		if err != nil {
+			log.Error("Error scanning row:", err)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Error("Error iterating through rows:", err)
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// query first and second column of every row to map, such as column name -> data type
+func (p *DbHandler) queryMap(sqltext string, args ...interface{}) (map[string]string, error) {
+	log.Tracef("%s sql: %s, args: %v\n", p.Dbconfig.Dbtype, sqltext, args)
+	if p.db == nil {
+		if err := p.openDB(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := p.db.Query(sqltext, args...)
+	if err != nil {
+		log.Error("Error executing query:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string]string)
+	var key, value string
+	for rows.Next() {
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			log.Error("Error scanning row:", err)
+			continue
+		}
+		m[key] = value
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Error("Error iterating through rows:", err)
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// query all columns of every row to string, null is empty string
+func (p *DbHandler) queryRows(sqltext string, args ...interface{}) ([][]string, error) {
+	log.Tracef("%s sql: %s, args: %v\n", p.Dbconfig.Dbtype, sqltext, args)
+	if p.db == nil {
+		if err := p.openDB(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := p.db.Query(sqltext, args...)
+	if err != nil {
+		log.Error("Error executing query:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Error("Error getting columns:", err)
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	values_ptr := make([]interface{}, len(columns))
+	for i := range values {
+		values_ptr[i] = &values[i]
+	}
+
+	records := make([][]string, 0)
+	for rows.Next() {
+		err = rows.Scan(values_ptr...)
+		if err != nil {
+			log.Error("Error scanning row:", err)
+			continue
+		}
+		record := make([]string, len(columns))
+		for i := range values {
+			record[i] = values[i].String
+		}
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Error("Error iterating through rows:", err)
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// dsn of datasource is empty, such as database which is not used
+var errDsnEmpty = errors.New("dsn is not configured")
+
+// dsn failed to parse when AddRouter, config of dsn is nil
+var errDsnInvalid = errors.New("dsn is invalid")
+
 func (p *DbHandler) openDB() error {
+	if len(p.Dbconfig.Dsn) == 0 || p.Dbconfig.Dsn[0] == "" {
+		return fmt.Errorf("%s %w", p.Dbconfig.Dbtype, errDsnEmpty)
+	}
+
 	//将空闲时间字符串解析为time.Duration类型
 	MaxIdleDuration, err := time.ParseDuration(p.Dbconfig.MaxIdleTime)
 	if err != nil {
 		return fmt.Errorf("parse dbconfig.maxidletime [%s] failed: %s", p.Dbconfig.MaxIdleTime, err)
 	}
 
+	// mysql reports rows matched instead of rows changed, so row update of same values is not 0
+	dsn := p.Dbconfig.Dsn[0]
+	if p.Dbconfig.Dbtype == "mysql" {
+		if cfg, err := mysql.ParseDSN(dsn); err == nil {
+			cfg.ClientFoundRows = true
+			dsn = cfg.FormatDSN()
+		}
+	}
+
 	//打开数据库连接
-	db, err := sql.Open(p.Dbconfig.Dbtype, p.Dbconfig.Dsn[0])
+	db, err := sql.Open(p.Dbconfig.Dbtype, dsn)
 	if err != nil {
 		log.Error("open database failed:", err)
 		return err
@@ -224,6 +366,29 @@ func (p *DbHandler) openDB() error {
 	return nil
 }
 
+// value of alert rule by rule.Query which returns one number
+func (p *DbHandler) alertValue(rule *AlertRule) (float64, error) {
+	if rule.Query == "" {
+		return 0, fmt.Errorf("query of %s alert rule '%s' is empty", p.Dbconfig.Dbtype, rule.Name)
+	}
+	values, err := p.queryColumn(rule.Query)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("query of alert rule '%s' returns no row", rule.Name)
+	}
+	return strconv.ParseFloat(values[0], 64)
+}
+
+// stats of dbpool, false when database is not opened
+func (p *DbHandler) Stats() (sql.DBStats, bool) {
+	if p.db == nil {
+		return sql.DBStats{}, false
+	}
+	return p.db.Stats(), true
+}
+
 func (p *DbHandler) Close() error {
 	if p.db != nil {
 		return p.db.Close()
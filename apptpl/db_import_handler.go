@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	log "github.com/sirupsen/logrus"
+
+	"goapptol/utils"
+)
+
+const (
+	IMPORT_MAX_ERRORS = 100 // default max number of row errors in import result
+)
+
+// one row error of import, line is line number of uploaded file
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importResult struct {
+	Table          string        `json:"table"`
+	Mode           string        `json:"mode"`
+	Filename       string        `json:"filename"`
+	Columns        []string      `json:"columns"`         // columns matched by header
+	IgnoredHeaders []string      `json:"ignored_headers"` // header not matched any column
+	Rows           int           `json:"rows"`
+	Valid          int           `json:"valid"`
+	Inserted       int           `json:"inserted"`
+	ErrorCount     int           `json:"error_count"`
+	Errors         []importError `json:"errors"`
+}
+
+// header of uploaded file mapped to column of table
+type importField struct {
+	header string
+	column string
+}
+
+// POST /table/:table/import?mode=dryrun|commit&max_errors=100
+// upload form file field 'file' of .xlsx, .csv or .ndjson, header is mapped to columns of table.
+// dryrun just coerce values and report errors, commit insert all rows in one transaction,
+// and rollback all when any row is failed.
+func (p *DbHandler) importRows(c fiber.Ctx, d sqlDialect, table string,
+	columns []string, types map[string]string) error {
+
+	mode := c.Query("mode", "dryrun")
+	if mode != "dryrun" && mode != "commit" {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("mode '%s' not supported", mode))
+	}
+	if mode == "commit" {
+		if err := p.checkWritable(); err != nil {
+			return err
+		}
+	}
+	if len(columns) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("table '%s' not found", table))
+	}
+	maxErrors := fiber.Query(c, "max_errors", IMPORT_MAX_ERRORS)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "form file 'file' is required: "+err.Error())
+	}
+	fp, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	result := &importResult{Table: table, Mode: mode, Filename: fh.Filename,
+		IgnoredHeaders: make([]string, 0), Errors: make([]importError, 0)}
+	addError := func(line int, msg string) {
+		result.ErrorCount++
+		if len(result.Errors) < maxErrors {
+			result.Errors = append(result.Errors, importError{Line: line, Error: msg})
+		}
+	}
+
+	var fields []importField
+	var tx *sql.Tx
+	var stmt *sql.Stmt
+	execFailed := false
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+		if tx != nil {
+			tx.Rollback() // no effect after commit
+		}
+	}()
+
+	err = utils.ReadRecords(fh.Filename, fp, func(line int, record map[string]interface{}) error {
+		// columns of insert is from header of first record
+		if fields == nil {
+			fields = matchImportFields(record, columns, result)
+			if len(fields) == 0 {
+				return fmt.Errorf("header of file not matched any column of table '%s'", table)
+			}
+			if mode == "commit" {
+				if tx, stmt, err = p.prepareImport(d, table, fields); err != nil {
+					return err
+				}
+			}
+		}
+
+		result.Rows++
+		args := make([]interface{}, len(fields))
+		for i, f := range fields {
+			v, err := coerceValue(record[f.header], types[f.column])
+			if err != nil {
+				addError(line, fmt.Sprintf("column '%s': %v", f.column, err))
+				return nil
+			}
+			args[i] = v
+		}
+		result.Valid++
+
+		// after one row failed, the transaction will be rollback, so not exec any more
+		if stmt != nil && !execFailed {
+			if _, err := stmt.Exec(args...); err != nil {
+				addError(line, err.Error())
+				execFailed = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("%s import table '%s' from '%s' failed: %v", p.Dbconfig.Dbtype, table, fh.Filename, err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	if tx != nil {
+		if result.ErrorCount == 0 {
+			stmt.Close()
+			stmt = nil
+			if err = tx.Commit(); err != nil {
+				addError(0, "commit failed: "+err.Error())
+			} else {
+				result.Inserted = result.Valid
+			}
+		}
+		auditLog(c, p.Dbconfig.Dbtype, "import", table, fiber.Map{
+			"filename": fh.Filename, "rows": result.Rows,
+			"inserted": result.Inserted, "error_count": result.ErrorCount})
+	}
+
+	if result.ErrorCount > 0 {
+		c.Status(fiber.StatusUnprocessableEntity) // 422
+	}
+	return c.JSON(result)
+}
+
+// begin transaction and prepare insert statement
+func (p *DbHandler) prepareImport(d sqlDialect, table string, fields []importField) (*sql.Tx, *sql.Stmt, error) {
+	if p.db == nil {
+		if err := p.openDB(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cols := make([]string, len(fields))
+	holders := make([]string, len(fields))
+	for i, f := range fields {
+		cols[i] = d.quote(f.column)
+		holders[i] = d.holder(i + 1)
+	}
+	sqltext := fmt.Sprintf("insert into %s (%s) values (%s)",
+		d.quote(table), strings.Join(cols, ", "), strings.Join(holders, ", "))
+	log.Tracef("%s SQL: %s\n", p.Dbconfig.Dbtype, sqltext)
+
+	tx, err := p.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	stmt, err := tx.Prepare(sqltext)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, stmt, nil
+}
+
+// match header to columns case insensitive, keep order of columns
+func matchImportFields(record map[string]interface{}, columns []string, result *importResult) []importField {
+	headers := make(map[string]string, len(record)) // lower header -> header
+	for h := range record {
+		headers[strings.ToLower(h)] = h
+	}
+
+	fields := make([]importField, 0, len(columns))
+	result.Columns = make([]string, 0, len(columns))
+	for _, col := range columns {
+		if h, ok := headers[strings.ToLower(col)]; ok {
+			fields = append(fields, importField{header: h, column: col})
+			result.Columns = append(result.Columns, col)
+			delete(headers, strings.ToLower(col))
+		}
+	}
+	for _, h := range headers {
+		result.IgnoredHeaders = append(result.IgnoredHeaders, h)
+	}
+	return fields
+}
+
+// coerce value of file to go type of column type, such as mysql 'int', postgresql 'timestamp with time zone',
+// clickhouse 'Nullable(Int32)'. clickhouse driver needs exactly go type, such as int32 for Int32.
+// empty value is null except string column.
+func coerceValue(v interface{}, coltype string) (interface{}, error) {
+	t := strings.ToLower(strings.TrimSpace(coltype))
+	for { // unwrap clickhouse Nullable(T) and LowCardinality(T)
+		if strings.HasPrefix(t, "nullable(") && strings.HasSuffix(t, ")") {
+			t = t[len("nullable(") : len(t)-1]
+		} else if strings.HasPrefix(t, "lowcardinality(") && strings.HasSuffix(t, ")") {
+			t = t[len("lowcardinality(") : len(t)-1]
+		} else {
+			break
+		}
+	}
+	// erase params and modifiers, such as decimal(10,2), double precision, datetime64(3)
+	if i := strings.IndexAny(t, "( "); i > 0 {
+		t = t[:i]
+	}
+
+	var s string
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		s = x
+	case json.Number:
+		s = x.String()
+	case bool:
+		s = strconv.FormatBool(x)
+	default: // json object or array of ndjson
+		b, err := json.Marshal(x)
+		return string(b), err
+	}
+	if strings.TrimSpace(s) == "" {
+		switch t {
+		case "char", "varchar", "text", "tinytext", "mediumtext", "longtext",
+			"character", "string", "fixedstring":
+			return s, nil
+		default:
+			return nil, nil
+		}
+	}
+	s = strings.TrimSpace(s)
+
+	switch t {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"serial", "smallserial", "bigserial":
+		return strconv.ParseInt(s, 10, 64)
+	case "int8", "int16", "int32", "int64": // clickhouse
+		bits, _ := strconv.Atoi(t[3:])
+		i, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch bits {
+		case 8:
+			return int8(i), nil
+		case 16:
+			return int16(i), nil
+		case 32:
+			return int32(i), nil
+		default:
+			return i, nil
+		}
+	case "uint8", "uint16", "uint32", "uint64": // clickhouse
+		bits, _ := strconv.Atoi(t[4:])
+		u, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, err
+		}
+		switch bits {
+		case 8:
+			return uint8(u), nil
+		case 16:
+			return uint16(u), nil
+		case 32:
+			return uint32(u), nil
+		default:
+			return u, nil
+		}
+	case "float32":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	case "float", "double", "real", "float64":
+		return strconv.ParseFloat(s, 64)
+	case "decimal", "numeric":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "bool", "boolean":
+		return strconv.ParseBool(s)
+	case "date", "date32", "datetime", "datetime64", "timestamp", "timestamptz":
+		return utils.ParseAnyDatetime(s)
+	default:
+		return s, nil
+	}
+}
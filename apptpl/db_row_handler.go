@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// sql dialect of row write and import api. mysql and clickhouse use `col` and ?, postgresql use "col" and $1
+type sqlDialect struct {
+	quote  func(name string) string
+	holder func(i int) string // i begin from 1
+}
+
+var mysqlDialect = sqlDialect{
+	quote:  func(name string) string { return "`" + strings.ReplaceAll(name, "`", "``") + "`" },
+	holder: func(i int) string { return "?" },
+}
+
+var pgDialect = sqlDialect{
+	quote:  func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` },
+	holder: func(i int) string { return fmt.Sprintf("$%d", i) },
+}
+
+var clickhouseDialect = sqlDialect{
+	quote:  mysqlDialect.quote,
+	holder: mysqlDialect.holder,
+}
+
+// table meta of row write api
+type rowTable struct {
+	name    string   // table name
+	columns []string // all columns sort by ordinal_position
+	pkeys   []string // primary key columns
+	version string   // optimistic lock column, empty means table has not
+}
+
+// version column is increased by 1, or set to now when it is a time column such as updated_at
+func (t *rowTable) versionIsTime() bool {
+	return strings.HasSuffix(t.version, "_at") || strings.HasSuffix(t.version, "_time")
+}
+
+// make rowTable from columns and primary keys, pick the optimistic lock column
+func (p *DbHandler) newRowTable(table string, columns, pkeys []string) (*rowTable, error) {
+	if len(columns) == 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("table '%s' not found", table))
+	}
+	t := &rowTable{name: table, columns: columns, pkeys: pkeys}
+
+	if p.Dbconfig.VersionColumn != "" {
+		if slices.Contains(columns, p.Dbconfig.VersionColumn) {
+			t.version = p.Dbconfig.VersionColumn
+		}
+	} else {
+		for _, col := range []string{"version", "updated_at"} {
+			if slices.Contains(columns, col) {
+				t.version = col
+				break
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// row write api is off by default, enabled by dbconfig.writable
+func (p *DbHandler) checkWritable() error {
+	if !p.Dbconfig.Writable {
+		return fiber.NewError(fiber.StatusForbidden,
+			fmt.Sprintf("%s row write api is disabled, set writable = true to enable", p.Dbconfig.Dbtype))
+	}
+	return nil
+}
+
+// parse request body of json object, keep numbers as json.Number
+func parseRowBody(c fiber.Ctx, t *rowTable) (map[string]interface{}, error) {
+	row := make(map[string]interface{})
+	dec := json.NewDecoder(bytes.NewReader(c.Body()))
+	dec.UseNumber()
+	if err := dec.Decode(&row); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	if len(row) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "empty json body")
+	}
+
+	for col := range row {
+		if !slices.Contains(t.columns, col) {
+			return nil, fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("column '%s' not found in table '%s'", col, t.name))
+		}
+	}
+	return row, nil
+}
+
+// make where clause by primary keys and version column, holder begin from n+1
+func (t *rowTable) where(d sqlDialect, row map[string]interface{}, n int) (string, []interface{}, error) {
+	if len(t.pkeys) == 0 {
+		return "", nil, fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("table '%s' has not primary key", t.name))
+	}
+
+	conds := make([]string, 0, len(t.pkeys)+1)
+	args := make([]interface{}, 0, len(t.pkeys)+1)
+	for _, pk := range t.pkeys {
+		v, ok := row[pk]
+		if !ok {
+			return "", nil, fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("primary key '%s' is required", pk))
+		}
+		n++
+		conds = append(conds, d.quote(pk)+" = "+d.holder(n))
+		args = append(args, v)
+	}
+
+	// optimistic concurrency, the version read by client must be given back
+	if t.version != "" {
+		v, ok := row[t.version]
+		if !ok {
+			return "", nil, fiber.NewError(fiber.StatusPreconditionRequired,
+				fmt.Sprintf("version column '%s' is required", t.version))
+		}
+		n++
+		conds = append(conds, d.quote(t.version)+" = "+d.holder(n))
+		args = append(args, v)
+	}
+
+	return strings.Join(conds, " and "), args, nil
+}
+
+// POST /table/:table/row, body is json object of columns
+func (p *DbHandler) insertRow(c fiber.Ctx, d sqlDialect, t *rowTable) error {
+	row, err := parseRowBody(c, t)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]string, 0, len(row))
+	holders := make([]string, 0, len(row))
+	args := make([]interface{}, 0, len(row))
+	for _, col := range t.columns { // keep order of columns
+		if v, ok := row[col]; ok {
+			cols = append(cols, d.quote(col))
+			holders = append(holders, d.holder(len(args)+1))
+			args = append(args, v)
+		}
+	}
+	sqltext := fmt.Sprintf("insert into %s (%s) values (%s)",
+		d.quote(t.name), strings.Join(cols, ", "), strings.Join(holders, ", "))
+
+	return p.execRow(c, "insert", t, sqltext, args, row)
+}
+
+// PUT|PATCH /table/:table/row, body is json object of primary keys, version and columns to update.
+// PUT must give all columns, PATCH give columns to update only.
+func (p *DbHandler) updateRow(c fiber.Ctx, d sqlDialect, t *rowTable, partial bool) error {
+	row, err := parseRowBody(c, t)
+	if err != nil {
+		return err
+	}
+
+	sets := make([]string, 0, len(row))
+	args := make([]interface{}, 0, len(row))
+	for _, col := range t.columns {
+		if slices.Contains(t.pkeys, col) || col == t.version {
+			continue
+		}
+		v, ok := row[col]
+		if !ok {
+			if !partial {
+				return fiber.NewError(fiber.StatusBadRequest,
+					fmt.Sprintf("column '%s' is required, use PATCH to update part of columns", col))
+			}
+			continue
+		}
+		sets = append(sets, d.quote(col)+" = "+d.holder(len(args)+1))
+		args = append(args, v)
+	}
+	if len(sets) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no column to update")
+	}
+
+	if t.version != "" {
+		if t.versionIsTime() {
+			sets = append(sets, d.quote(t.version)+" = CURRENT_TIMESTAMP")
+		} else {
+			sets = append(sets, d.quote(t.version)+" = "+d.quote(t.version)+" + 1")
+		}
+	}
+
+	where, whereArgs, err := t.where(d, row, len(args))
+	if err != nil {
+		return err
+	}
+	sqltext := fmt.Sprintf("update %s set %s where %s",
+		d.quote(t.name), strings.Join(sets, ", "), where)
+	args = append(args, whereArgs...)
+
+	action := "update"
+	if partial {
+		action = "patch"
+	}
+	return p.execRow(c, action, t, sqltext, args, row)
+}
+
+// DELETE /table/:table/row, body is json object of primary keys and version
+func (p *DbHandler) deleteRow(c fiber.Ctx, d sqlDialect, t *rowTable) error {
+	row, err := parseRowBody(c, t)
+	if err != nil {
+		return err
+	}
+
+	where, args, err := t.where(d, row, 0)
+	if err != nil {
+		return err
+	}
+	sqltext := fmt.Sprintf("delete from %s where %s", d.quote(t.name), where)
+
+	return p.execRow(c, "delete", t, sqltext, args, row)
+}
+
+// exec write sql, then write audit log and response of rows affected
+func (p *DbHandler) execRow(c fiber.Ctx, action string, t *rowTable,
+	sqltext string, args []interface{}, row map[string]interface{}) error {
+
+	log.Tracef("%s SQL: %s, args: %v\n", p.Dbconfig.Dbtype, sqltext, args)
+	if p.db == nil {
+		if err := p.openDB(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MAX_TIMEOUT*time.Second)
+	defer cancel()
+
+	result, err := p.db.ExecContext(ctx, sqltext, args...)
+	if err != nil {
+		log.Errorf("%s %s table '%s' failed: %v", p.Dbconfig.Dbtype, action, t.name, err)
+		auditLog(c, p.Dbconfig.Dbtype, action, t.name, fiber.Map{"row": row, "error": err.Error()})
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	affected, _ := result.RowsAffected()
+	auditLog(c, p.Dbconfig.Dbtype, action, t.name, fiber.Map{"row": row, "rows_affected": affected})
+
+	if affected == 0 && action != "insert" {
+		// row is not existed, or is changed by others after client read it
+		return fiber.NewError(fiber.StatusConflict,
+			fmt.Sprintf("%s table '%s' affected 0 rows, row not found or version mismatch", action, t.name))
+	}
+
+	m := fiber.Map{"rows_affected": affected}
+	if id, err := result.LastInsertId(); err == nil && action == "insert" {
+		m["last_insert_id"] = id
+	}
+	return c.JSON(m)
+}
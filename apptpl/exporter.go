@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+// send export file log/<filename> such as excel and docx as attachment, then remove it.
+// with query dest=minio://bucket/prefix/, the file is uploaded to minio instead (admin role only),
+// and response is location of object and presigned url to download it.
+func sendExport(c fiber.Ctx, minioHdl *MinioHandler, filename string) error {
+	name := "log/" + filename
+	defer os.Remove(name)
+
+	if dest := c.Query("dest"); dest != "" {
+		return exportToMinio(c, minioHdl, dest, name, filename)
+	}
+
+	c.Attachment(filename)
+	fp, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(c, fp)
+	fp.Close()
+	return err
+}
+
+// upload export file to minio, object name is prefix + filename with time, such as
+// 'reports/mydb-tables-20240102150405.xlsx', so that exports of schedule are kept.
+func exportToMinio(c fiber.Ctx, minioHdl *MinioHandler, dest, name, filename string) error {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "minio" || u.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid dest '%s', should be minio://bucket/prefix/", dest))
+	}
+	if role, _ := c.Locals("role").(string); role != "admin" {
+		return fiber.NewError(fiber.StatusForbidden, "admin role is required to export to minio")
+	}
+	if minioHdl == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "minio is not configured")
+	}
+	if minioHdl.cli == nil {
+		if err := minioHdl.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	bucket := u.Host
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	ext := path.Ext(filename)
+	object := prefix + strings.TrimSuffix(filename, ext) + "-" + time.Now().Format("20060102150405") + ext
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second*time.Duration(minioHdl.Minioconfig.Timeout))
+	defer cancel()
+
+	info, err := minioHdl.cli.FPutObject(ctx, bucket, object, name,
+		minio.PutObjectOptions{ContentType: mime.TypeByExtension(ext)})
+	detail := fiber.Map{"file": filename}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", "export", bucket+"/"+object, detail)
+	if err != nil {
+		log.Errorf("export '%s' to minio '%s/%s' failed: %v", filename, bucket, object, err)
+		return minioError(err)
+	}
+
+	result := fiber.Map{"bucket": bucket, "object": object, "size": info.Size, "etag": info.ETag}
+	expires := time.Duration(MINIO_PRESIGN_EXPIRES) * time.Second
+	if cli, err := minioHdl.presignClient(); err == nil {
+		params := url.Values{}
+		params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(object)))
+		if link, err := cli.PresignedGetObject(ctx, bucket, object, expires, params); err == nil {
+			result["url"] = link.String()
+			result["expires_at"] = time.Now().Add(expires)
+		} else {
+			log.Errorf("presign export '%s/%s' failed: %v", bucket, object, err)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(result)
+}
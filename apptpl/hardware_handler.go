@@ -57,7 +57,7 @@ func (p *HardwareHandler) hdHandler(c fiber.Ctx) error {
 
 // GET /hardware/cpu
 func (p *HardwareHandler) cpuHandler(c fiber.Ctx) error {
-	if b, found := p.Mycache.Get(c.Path()); found {
+	if b, found := cacheGet(p.Mycache, c.Path()); found {
 		c.Response().Header.Set("Content-Type", "application/json")
 		c.Write(b.([]byte))
 		return nil
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -18,6 +20,7 @@ import (
 
 type HostHandler struct {
 	Mycache *cache.Cache
+	Sampler *HostSampler // background sampler of loading and history
 }
 
 // r := app.Group("/host")
@@ -30,10 +33,14 @@ func (p *HostHandler) AddRouter(r fiber.Router) error {
 	r.Get("/user", p.userHandler)
 	r.Get("/cpu", p.cpuHandler)
 	r.Get("/loading", p.loadingHandler)
+	r.Get("/history", p.historyHandler)
 	r.Get("/mem", p.memHandler)
 	r.Get("/disk", p.diskHandler)
 	r.Get("/net", p.netHandler)
 	r.Get("/process", p.processHandler)
+	r.Get("/process/top", p.processTopHandler)
+	r.Get("/process/tree", adminOnly, p.processTreeHandler)
+	r.Get("/process/:pid", adminOnly, p.processDetailHandler)
 
 	return nil
 }
@@ -46,10 +53,14 @@ func (p *HostHandler) homeHandler(c fiber.Ctx) error {
 	<a href="/host/user">user</a><br>
 	<a href="/host/cpu">cpu</a><br>
 	<a href="/host/loading">loading</a><br>
+	<a href="/host/history">history?metric=cpu,mem,disk,net,load&from=1h&to=&step=1m</a><br>
 	<a href="/host/mem">mem</a><br>
 	<a href="/host/disk">disk</a><br>
 	<a href="/host/net">net</a><br>
 	<a href="/host/process">process</a><br>
+	<a href="/host/process/top?by=cpu&n=10">process/top?by=cpu|mem&n=10</a><br>
+	<a href="/host/process/tree?format=text">process/tree?pid=&format=json|text</a>（admin）<br>
+	<a href="/host/process/1">process/:pid</a>（admin）<br>
 	</body></html>`)
 	return nil
 }
@@ -133,35 +144,39 @@ func (p *HostHandler) cpuHandler(c fiber.Ctx) error {
 	return nil
 }
 
-// GET /host/loading
+// GET /host/loading, the latest sample of sampler.
+// cpu is sampled for 1 second when sampler is disabled or there is no sample yet.
 func (p *HostHandler) loadingHandler(c fiber.Ctx) error {
-	s := fmt.Sprintf(`{"timestamp": "%s", `, time.Now().Format(time.RFC3339))
-	s += `"measurement": "MiB", `
-	v, _ := mem.VirtualMemory()
-	s += fmt.Sprintf(`"mem_total": %v, `, v.Total)
-	s += fmt.Sprintf(`"mem_available": %v, `, v.Available)
-	s += fmt.Sprintf(`"mem_used_percent": %.2f, `, v.UsedPercent)
-
-	totalPercent, _ := cpu.Percent(3*time.Second, false)
-	perPercents, _ := cpu.Percent(3*time.Second, true)
-	// fmt.Printf("total percent:%v per percents:%v", totalPercent, perPercents)
-	s += `"cpu_percent": [ `
-	for i := range totalPercent {
-		if i > 0 {
-			s += ", "
+	sample, ok := HostSample{}, false
+	if p.Sampler != nil {
+		sample, ok = p.Sampler.Latest()
+	}
+	if !ok {
+		sample.Time = time.Now()
+		if v, err := mem.VirtualMemory(); err == nil {
+			sample.MemTotal, sample.MemAvailable, sample.MemUsedPercent = v.Total, v.Available, v.UsedPercent
+		}
+		sample.CpuPerPercent, _ = cpu.Percent(time.Second, true)
+		for _, percent := range sample.CpuPerPercent {
+			sample.CpuPercent += percent / float64(len(sample.CpuPerPercent))
 		}
-		s += fmt.Sprintf("%.2f", totalPercent[i])
 	}
 
-	s += `] ,"cpu_per_percent": [ `
-	for i := range perPercents {
+	s := fmt.Sprintf(`{"timestamp": "%s", `, sample.Time.Format(time.RFC3339))
+	s += `"measurement": "MiB", `
+	s += fmt.Sprintf(`"mem_total": %v, `, sample.MemTotal)
+	s += fmt.Sprintf(`"mem_available": %v, `, sample.MemAvailable)
+	s += fmt.Sprintf(`"mem_used_percent": %.2f, `, sample.MemUsedPercent)
+	s += fmt.Sprintf(`"cpu_percent": [ %.2f ], `, sample.CpuPercent)
+	s += `"cpu_per_percent": [ `
+	for i := range sample.CpuPerPercent {
 		if i > 0 {
 			s += ", "
 		}
-		s += fmt.Sprintf("%.2f", perPercents[i])
+		s += fmt.Sprintf("%.2f", sample.CpuPerPercent[i])
 	}
-
-	s += `]}`
+	s += `], `
+	s += fmt.Sprintf(`"load": [ %.2f, %.2f, %.2f ]}`, sample.Load1, sample.Load5, sample.Load15)
 
 	c.Response().Header.Set("Content-Type", "application/json")
 	c.WriteString(s)
@@ -169,6 +184,140 @@ func (p *HostHandler) loadingHandler(c fiber.Ctx) error {
 	return nil
 }
 
+// GET /host/history?metric=cpu,mem,disk,net,load&from=1h&to=&step=1m
+// samples of sampler for charts, fields are arrays of the same length as time (unix milliseconds).
+// from and to are RFC3339, unix seconds, or duration before now such as '1h', default the last hour.
+// samples are averaged by step, default no average.
+func (p *HostHandler) historyHandler(c fiber.Ctx) error {
+	if p.Sampler == nil || !p.Sampler.Enabled() {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "host sampler is disabled")
+	}
+	now := time.Now()
+	from, err := parseTimeQuery(c.Query("from"), now.Add(-time.Hour), now)
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeQuery(c.Query("to"), now, now)
+	if err != nil {
+		return err
+	}
+	var step time.Duration
+	if q := c.Query("step"); q != "" {
+		if step, err = time.ParseDuration(q); err != nil || step <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid step '%s'", q))
+		}
+	}
+
+	// fields of metric groups
+	groups := map[string][]string{
+		"cpu":  {"cpu_percent"},
+		"mem":  {"mem_used_percent", "mem_available"},
+		"disk": {"disk_read_bps", "disk_write_bps"},
+		"net":  {"net_recv_bps", "net_sent_bps"},
+		"load": {"load1", "load5", "load15"},
+	}
+	metrics := splitQuery(c.Query("metric", "cpu,mem,disk,net,load"))
+	fields := make([]string, 0)
+	for _, metric := range metrics {
+		names, ok := groups[metric]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("invalid metric '%s', should be cpu, mem, disk, net or load", metric))
+		}
+		fields = append(fields, names...)
+	}
+	value := func(s *HostSample, field string) float64 {
+		switch field {
+		case "cpu_percent":
+			return s.CpuPercent
+		case "mem_used_percent":
+			return s.MemUsedPercent
+		case "mem_available":
+			return float64(s.MemAvailable)
+		case "disk_read_bps":
+			return s.DiskReadBps
+		case "disk_write_bps":
+			return s.DiskWriteBps
+		case "net_recv_bps":
+			return s.NetRecvBps
+		case "net_sent_bps":
+			return s.NetSentBps
+		case "load1":
+			return s.Load1
+		case "load5":
+			return s.Load5
+		default:
+			return s.Load15
+		}
+	}
+
+	times := make([]int64, 0)
+	series := make(map[string][]float64)
+	sums := make([]float64, len(fields))
+	n := 0
+	var bucket time.Time
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		times = append(times, bucket.UnixMilli())
+		for i, field := range fields {
+			series[field] = append(series[field], math.Round(sums[i]/float64(n)*100)/100)
+			sums[i] = 0
+		}
+		n = 0
+	}
+	for _, sample := range p.Sampler.Range(from, to) {
+		t := sample.Time
+		if step > 0 {
+			t = from.Add(sample.Time.Sub(from) / step * step)
+		}
+		if n > 0 && !t.Equal(bucket) {
+			flush()
+		}
+		bucket = t
+		for i, field := range fields {
+			sums[i] += value(&sample, field)
+		}
+		n++
+	}
+	flush()
+
+	result := fiber.Map{
+		"from":     from,
+		"to":       to,
+		"interval": p.Sampler.Samplerconfig.Interval,
+		"step":     step.String(),
+		"metrics":  metrics,
+		"time":     times,
+	}
+	for _, field := range fields {
+		if series[field] == nil {
+			series[field] = []float64{}
+		}
+		result[field] = series[field]
+	}
+	return c.JSON(result)
+}
+
+// time of RFC3339, unix seconds, or duration before now such as '1h'
+func parseTimeQuery(q string, def, now time.Time) (time.Time, error) {
+	if q == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, q); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(q, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if d, err := time.ParseDuration(q); err == nil {
+		return now.Add(-d), nil
+	}
+	return def, fiber.NewError(fiber.StatusBadRequest,
+		fmt.Sprintf("invalid time '%s', should be RFC3339, unix seconds or duration such as 1h", q))
+}
+
 // GET /host/mem
 func (p *HostHandler) memHandler(c fiber.Ctx) error {
 	v, _ := mem.VirtualMemory()
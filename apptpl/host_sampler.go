@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	psnet "github.com/shirou/gopsutil/v4/net"
+	log "github.com/sirupsen/logrus"
+
+	"goapptol/utils"
+)
+
+const (
+	SAMPLER_INTERVAL = "10s"
+	SAMPLER_KEEP     = 8640 // samples in memory, 24 hours of 10s
+	SAMPLER_SAVE     = 60   // save samples to file every SAMPLER_SAVE samples
+)
+
+// metrics of host at sample time, rates are per second since the last sample
+type HostSample struct {
+	Time           time.Time `json:"time"`
+	CpuPercent     float64   `json:"cpu_percent"`
+	CpuPerPercent  []float64 `json:"cpu_per_percent"`
+	MemTotal       uint64    `json:"mem_total"`
+	MemAvailable   uint64    `json:"mem_available"`
+	MemUsedPercent float64   `json:"mem_used_percent"`
+	DiskReadBps    float64   `json:"disk_read_bps"`
+	DiskWriteBps   float64   `json:"disk_write_bps"`
+	NetRecvBps     float64   `json:"net_recv_bps"`
+	NetSentBps     float64   `json:"net_sent_bps"`
+	Load1          float64   `json:"load1"`
+	Load5          float64   `json:"load5"`
+	Load15         float64   `json:"load15"`
+}
+
+// sample host metrics every interval into ring buffer of SamplerConfig.Keep samples,
+// and save them to SamplerConfig.Path so that history is kept after restart.
+type HostSampler struct {
+	Samplerconfig *SamplerConfig
+	samples       []HostSample // ring buffer
+	next          int          // index of next sample
+	count         int
+	mutex         sync.RWMutex
+	done          chan struct{}
+	wg            sync.WaitGroup
+
+	// counters of the last sample to compute rates
+	lastTime  time.Time
+	lastDisk  [2]uint64 // read bytes, write bytes
+	lastNet   [2]uint64 // recv bytes, sent bytes
+	lastValid bool
+}
+
+func (p *HostSampler) Start() error {
+	if !p.Samplerconfig.Enable {
+		log.Info("host sampler is disabled")
+		return nil
+	}
+	if p.Samplerconfig.Interval == "" {
+		p.Samplerconfig.Interval = SAMPLER_INTERVAL
+	}
+	interval, err := time.ParseDuration(p.Samplerconfig.Interval)
+	if err != nil || interval < time.Second {
+		return fmt.Errorf("invalid sampler.interval [%s], should be 1s at least", p.Samplerconfig.Interval)
+	}
+	if p.Samplerconfig.Keep <= 0 {
+		p.Samplerconfig.Keep = SAMPLER_KEEP
+	}
+	p.samples = make([]HostSample, p.Samplerconfig.Keep)
+	if err := p.load(); err != nil {
+		log.Warnf("load host samples from %s failed: %v", p.Samplerconfig.Path, err)
+	}
+
+	p.sample() // counters and cpu times of the first sample are base of rates
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		n := 0
+		for {
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				log.Debug("host sampler stop")
+				return
+			}
+			p.add(p.sample())
+			if n++; n%SAMPLER_SAVE == 0 {
+				if err := p.save(); err != nil {
+					log.Warnf("save host samples to %s failed: %v", p.Samplerconfig.Path, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (p *HostSampler) Stop() {
+	if p.done == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+	p.done = nil
+	if err := p.save(); err != nil {
+		log.Warnf("save host samples to %s failed: %v", p.Samplerconfig.Path, err)
+	}
+}
+
+// sample metrics now, cpu percent is since the last sample and never blocks
+func (p *HostSampler) sample() HostSample {
+	now := time.Now()
+	s := HostSample{Time: now}
+	if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+		s.CpuPercent = percents[0]
+	}
+	s.CpuPerPercent, _ = cpu.Percent(0, true)
+	if v, err := mem.VirtualMemory(); err == nil {
+		s.MemTotal, s.MemAvailable, s.MemUsedPercent = v.Total, v.Available, v.UsedPercent
+	}
+	if avg, err := load.Avg(); err == nil {
+		s.Load1, s.Load5, s.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+
+	diskBytes := diskCounters()
+	netBytes := netCounters()
+	if p.lastValid {
+		seconds := now.Sub(p.lastTime).Seconds()
+		rate := func(cur, last uint64) float64 {
+			if cur < last || seconds <= 0 { // counter is reset
+				return 0
+			}
+			return float64(cur-last) / seconds
+		}
+		s.DiskReadBps, s.DiskWriteBps = rate(diskBytes[0], p.lastDisk[0]), rate(diskBytes[1], p.lastDisk[1])
+		s.NetRecvBps, s.NetSentBps = rate(netBytes[0], p.lastNet[0]), rate(netBytes[1], p.lastNet[1])
+	}
+	p.lastTime, p.lastDisk, p.lastNet, p.lastValid = now, diskBytes, netBytes, true
+
+	return s
+}
+
+// read and write bytes of disks, partitions such as sda1 are not counted again of sda
+func diskCounters() [2]uint64 {
+	var total [2]uint64
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return total
+	}
+	for name, c := range counters {
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		partition := false
+		for other := range counters {
+			if other != name && strings.HasPrefix(name, other) {
+				partition = true
+				break
+			}
+		}
+		if !partition {
+			total[0] += c.ReadBytes
+			total[1] += c.WriteBytes
+		}
+	}
+	return total
+}
+
+// received and sent bytes of network interfaces except loopback
+func netCounters() [2]uint64 {
+	var total [2]uint64
+	counters, err := psnet.IOCounters(true)
+	if err != nil {
+		return total
+	}
+	for _, c := range counters {
+		if c.Name == "lo" || strings.HasPrefix(c.Name, "lo0") {
+			continue
+		}
+		total[0] += c.BytesRecv
+		total[1] += c.BytesSent
+	}
+	return total
+}
+
+// value of alert rule of source host, disk_used_percent is usage of mountpoint rule.Path,
+// others are of the latest sample
+func (p *HostSampler) alertValue(rule *AlertRule) (float64, error) {
+	if rule.Metric == "disk_used_percent" {
+		mountpoint := rule.Path
+		if mountpoint == "" {
+			mountpoint = "/"
+		}
+		usage, err := disk.Usage(mountpoint)
+		if err != nil {
+			return 0, err
+		}
+		return usage.UsedPercent, nil
+	}
+
+	s, ok := p.Latest()
+	if !ok {
+		return 0, fmt.Errorf("no host sample, sampler is disabled or not started")
+	}
+	switch rule.Metric {
+	case "cpu_percent":
+		return s.CpuPercent, nil
+	case "mem_used_percent":
+		return s.MemUsedPercent, nil
+	case "load1":
+		return s.Load1, nil
+	case "load5":
+		return s.Load5, nil
+	case "load15":
+		return s.Load15, nil
+	case "disk_read_bps":
+		return s.DiskReadBps, nil
+	case "disk_write_bps":
+		return s.DiskWriteBps, nil
+	case "net_recv_bps":
+		return s.NetRecvBps, nil
+	case "net_sent_bps":
+		return s.NetSentBps, nil
+	}
+	return 0, fmt.Errorf("unknown host metric '%s'", rule.Metric)
+}
+
+func (p *HostSampler) add(s HostSample) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.samples[p.next] = s
+	p.next = (p.next + 1) % len(p.samples)
+	p.count = min(p.count+1, len(p.samples))
+}
+
+// sampler is started or samples are kept
+func (p *HostSampler) Enabled() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.samples != nil
+}
+
+// the latest sample, false when sampler is disabled or there is no sample yet
+func (p *HostSampler) Latest() (HostSample, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.count == 0 {
+		return HostSample{}, false
+	}
+	return p.samples[(p.next-1+len(p.samples))%len(p.samples)], true
+}
+
+// samples of time range [from, to] sort by time
+func (p *HostSampler) Range(from, to time.Time) []HostSample {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	list := make([]HostSample, 0)
+	for _, s := range p.rangeLocked() {
+		if !s.Time.Before(from) && !s.Time.After(to) {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// all samples sort by time, should be locked by caller
+func (p *HostSampler) rangeLocked() []HostSample {
+	list := make([]HostSample, 0, p.count)
+	for i := 0; i < p.count; i++ {
+		list = append(list, p.samples[(p.next-p.count+i+len(p.samples))%len(p.samples)])
+	}
+	return list
+}
+
+// save samples to file of json array, write to temp file then rename
+func (p *HostSampler) save() error {
+	if p.Samplerconfig.Path == "" || p.samples == nil {
+		return nil
+	}
+	p.mutex.RLock()
+	b, err := json.Marshal(p.rangeLocked())
+	p.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err = utils.CheckMakeDir(filepath.Dir(p.Samplerconfig.Path)); err != nil {
+		return err
+	}
+	tmp := p.Samplerconfig.Path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.Samplerconfig.Path)
+}
+
+// load samples saved by the last run, the latest Keep samples are kept
+func (p *HostSampler) load() error {
+	if p.Samplerconfig.Path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(p.Samplerconfig.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	list := make([]HostSample, 0)
+	if err = json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	if len(list) > len(p.samples) {
+		list = list[len(list)-len(p.samples):]
+	}
+	for _, s := range list {
+		p.add(s)
+	}
+	log.Infof("load %d host samples from %s", len(list), p.Samplerconfig.Path)
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	JOB_KEEP_FINISHED = 100 // max finished jobs kept in memory
+)
+
+const (
+	JOB_RUNNING  = "running"
+	JOB_DONE     = "done"
+	JOB_FAILED   = "failed"
+	JOB_CANCELED = "canceled"
+)
+
+// background job such as bulk delete of redis keys, progress is done of total
+type Job struct {
+	Id        string
+	Kind      string
+	Target    string
+	User      string
+	Status    string
+	Done      int64
+	Total     int64 // 0 is unknown
+	Message   string
+	Error     string
+	Result    interface{}
+	StartTime time.Time
+	EndTime   time.Time
+
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+}
+
+// set progress of job, called in job routine
+func (job *Job) SetProgress(done, total int64, message string) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.Done = done
+	job.Total = total
+	job.Message = message
+}
+
+func (job *Job) AddDone(n int64) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.Done += n
+}
+
+func (job *Job) Running() bool {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.Status == JOB_RUNNING
+}
+
+// copy of job for json response
+func (job *Job) info() fiber.Map {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	m := fiber.Map{
+		"id": job.Id, "kind": job.Kind, "target": job.Target, "user": job.User,
+		"status": job.Status, "done": job.Done, "total": job.Total,
+		"start_time": job.StartTime,
+	}
+	if job.Message != "" {
+		m["message"] = job.Message
+	}
+	if job.Error != "" {
+		m["error"] = job.Error
+	}
+	if job.Result != nil {
+		m["result"] = job.Result
+	}
+	if !job.EndTime.IsZero() {
+		m["end_time"] = job.EndTime
+	}
+	return m
+}
+
+// manage background jobs in memory, finished jobs are kept for query
+type JobManager struct {
+	jobs  map[string]*Job
+	mutex sync.Mutex
+	seq   atomic.Int64
+}
+
+// r := app.Group("/jobs")
+func (p *JobManager) AddRouter(r fiber.Router) error {
+	log.Info("JobManager AddRouter")
+
+	r.Get("", p.jobsHandler)
+	r.Get("/", p.jobsHandler)
+	r.Get("/:id", p.jobHandler)
+	r.Delete("/:id", adminOnly, p.cancelHandler)
+
+	return nil
+}
+
+// start fn in background routine, result of fn is saved to job when done.
+// fn should check ctx.Done() to stop when job is canceled.
+func (p *JobManager) Start(c fiber.Ctx, kind, target string,
+	fn func(ctx context.Context, job *Job) (interface{}, error)) *Job {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	user, _ := c.Locals("user").(string)
+	job := &Job{
+		Id:        fmt.Sprintf("%s-%d-%d", kind, time.Now().Unix(), p.seq.Add(1)),
+		Kind:      kind,
+		Target:    target,
+		User:      user,
+		Status:    JOB_RUNNING,
+		StartTime: time.Now(),
+		cancel:    cancel,
+	}
+
+	p.mutex.Lock()
+	if p.jobs == nil {
+		p.jobs = make(map[string]*Job)
+	}
+	p.jobs[job.Id] = job
+	p.cleanup()
+	p.mutex.Unlock()
+
+	log.Infof("job %s start, target: %s", job.Id, target)
+	go func() {
+		defer cancel()
+		result, err := fn(ctx, job)
+
+		job.mutex.Lock()
+		defer job.mutex.Unlock()
+		job.Result = result
+		job.EndTime = time.Now()
+		switch {
+		case ctx.Err() == context.Canceled:
+			job.Status = JOB_CANCELED
+		case err != nil:
+			job.Status = JOB_FAILED
+			job.Error = err.Error()
+		default:
+			job.Status = JOB_DONE
+		}
+		log.Infof("job %s %s, done %d of %d", job.Id, job.Status, job.Done, job.Total)
+	}()
+
+	return job
+}
+
+// remove the oldest finished jobs, keep JOB_KEEP_FINISHED. should be locked by caller
+func (p *JobManager) cleanup() {
+	finished := make([]*Job, 0)
+	for _, job := range p.jobs {
+		job.mutex.Lock()
+		if job.Status != JOB_RUNNING {
+			finished = append(finished, job)
+		}
+		job.mutex.Unlock()
+	}
+	if len(finished) <= JOB_KEEP_FINISHED {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].StartTime.Before(finished[j].StartTime) })
+	for _, job := range finished[:len(finished)-JOB_KEEP_FINISHED] {
+		delete(p.jobs, job.Id)
+	}
+}
+
+func (p *JobManager) Get(id string) (*Job, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	job, ok := p.jobs[id]
+	return job, ok
+}
+
+// cancel all running jobs
+func (p *JobManager) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, job := range p.jobs {
+		job.cancel()
+	}
+}
+
+// GET /jobs?kind=, the latest first
+func (p *JobManager) jobsHandler(c fiber.Ctx) error {
+	kind := c.Query("kind")
+
+	p.mutex.Lock()
+	jobs := make([]*Job, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		if kind == "" || job.Kind == kind {
+			jobs = append(jobs, job)
+		}
+	}
+	p.mutex.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartTime.After(jobs[j].StartTime) })
+	list := make([]fiber.Map, len(jobs))
+	for i, job := range jobs {
+		list[i] = job.info()
+	}
+	return c.JSON(list)
+}
+
+// GET /jobs/:id
+func (p *JobManager) jobHandler(c fiber.Ctx) error {
+	job, ok := p.Get(c.Params("id"))
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("job '%s' not found", c.Params("id")))
+	}
+	return c.JSON(job.info())
+}
+
+// DELETE /jobs/:id, cancel running job
+func (p *JobManager) cancelHandler(c fiber.Ctx) error {
+	job, ok := p.Get(c.Params("id"))
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("job '%s' not found", c.Params("id")))
+	}
+	job.cancel()
+	auditLog(c, "job", "cancel", job.Id, nil)
+	return c.JSON(job.info())
+}
@@ -22,7 +22,8 @@ var (
 	myconfig      *MyConfig
 )
 
-func init() {
+// parse command line, load config and init log
+func setup() {
 	// parse command line
 	flag.Parse()
 	if *param_version {
@@ -57,6 +58,13 @@ func init() {
 		fmt.Printf("InitLogRotate error %s\n", err)
 		os.Exit(1)
 	}
+	err = utils.InitAuditLog(myconfig.LogConfig.Path, myconfig.LogConfig.AuditFilename,
+		myconfig.LogConfig.Rotate_files,
+		myconfig.LogConfig.Rotate_mbytes)
+	if err != nil {
+		fmt.Printf("InitAuditLog error %s\n", err)
+		os.Exit(1)
+	}
 
 	log.Infof("BEGIN... %v, config=%v",
 		START_TIME.Format("2006-01-02 15:04:05"), *param_config)
@@ -64,6 +72,8 @@ func init() {
 }
 
 func main() {
+	setup()
+
 	var done = make(chan bool, 2)
 	var wg sync.WaitGroup
 
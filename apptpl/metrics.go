@@ -0,0 +1,375 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/patrickmn/go-cache"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	log "github.com/sirupsen/logrus"
+)
+
+// upper bounds of latency histogram in seconds
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// hits and misses of Mycache by cacheGet
+var cacheHits, cacheMisses atomic.Int64
+
+// Get of Mycache which is counted for hit ratio of /metrics
+func cacheGet(c *cache.Cache, key string) (interface{}, bool) {
+	v, found := c.Get(key)
+	if found {
+		cacheHits.Add(1)
+	} else {
+		cacheMisses.Add(1)
+	}
+	return v, found
+}
+
+type latencyHistogram struct {
+	buckets []uint64 // count of each bound, not cumulative
+	sum     float64
+	count   uint64
+}
+
+// Prometheus metrics of http requests per route, pools of database and redis, cache and host.
+// r := app.Get("/metrics", metrics.metricsHandler), app.Use(metrics.middleware) before other routes
+type Metrics struct {
+	Dbs     map[string]*DbHandler // name such as mysql is label of db
+	Redis   *RedisHandler
+	Cache   *cache.Cache
+	Sampler *HostSampler
+
+	requests  map[[3]string]uint64 // method, route, status
+	latencies map[[2]string]*latencyHistogram
+	mutex     sync.Mutex
+}
+
+// count requests and latency by route pattern such as /minio/bucket/:bucket/object/*,
+// not path, so that labels are limited. requests of no route are 'unmatched'.
+func (p *Metrics) middleware(c fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	elapsed := time.Since(start).Seconds()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+	}
+	route := c.Route().Path
+	if status == fiber.StatusNotFound && route == "/" { // route of app.Use
+		route = "unmatched"
+	}
+	method := c.Method()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.requests == nil {
+		p.requests = make(map[[3]string]uint64)
+		p.latencies = make(map[[2]string]*latencyHistogram)
+	}
+	p.requests[[3]string{method, route, strconv.Itoa(status)}]++
+	h, ok := p.latencies[[2]string{method, route}]
+	if !ok {
+		h = &latencyHistogram{buckets: make([]uint64, len(metricsBuckets))}
+		p.latencies[[2]string{method, route}] = h
+	}
+	for i, bound := range metricsBuckets {
+		if elapsed <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.sum += elapsed
+	h.count++
+
+	return err
+}
+
+// GET /metrics, Prometheus text format
+func (p *Metrics) metricsHandler(c fiber.Ctx) error {
+	w := &metricsWriter{}
+	p.writeHttp(w)
+	p.writeDbs(w)
+	p.writeRedis(w)
+	p.writeCache(w)
+	p.writeHost(w)
+	p.writeRuntime(w)
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(w.String())
+}
+
+func (p *Metrics) writeHttp(w *metricsWriter) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	keys := make([][3]string, 0, len(p.requests))
+	for k := range p.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return strings.Join(keys[i][:], " ") < strings.Join(keys[j][:], " ") })
+	w.header("http_requests_total", "counter", "Number of http requests by route and status.")
+	for _, k := range keys {
+		w.value("http_requests_total", labels("method", k[0], "route", k[1], "status", k[2]), float64(p.requests[k]))
+	}
+
+	routes := make([][2]string, 0, len(p.latencies))
+	for k := range p.latencies {
+		routes = append(routes, k)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i][1]+routes[i][0] < routes[j][1]+routes[j][0] })
+	name := "http_request_duration_seconds"
+	w.header(name, "histogram", "Latency of http requests by route.")
+	for _, k := range routes {
+		h := p.latencies[k]
+		var cumulative uint64
+		for i, bound := range metricsBuckets {
+			cumulative += h.buckets[i]
+			w.value(name+"_bucket", labels("method", k[0], "route", k[1], "le", formatFloat(bound)), float64(cumulative))
+		}
+		w.value(name+"_bucket", labels("method", k[0], "route", k[1], "le", "+Inf"), float64(h.count))
+		w.value(name+"_sum", labels("method", k[0], "route", k[1]), h.sum)
+		w.value(name+"_count", labels("method", k[0], "route", k[1]), float64(h.count))
+	}
+}
+
+// sql.DBStats of opened databases
+func (p *Metrics) writeDbs(w *metricsWriter) {
+	names := make([]string, 0, len(p.Dbs))
+	for name := range p.Dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type dbMetric struct {
+		name, kind, help string
+		value            func(s *sql.DBStats) float64
+	}
+	metrics := []dbMetric{
+		{"db_pool_max_open_connections", "gauge", "Maximum number of open connections.", func(s *sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"db_pool_open_connections", "gauge", "Number of established connections.", func(s *sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"db_pool_in_use_connections", "gauge", "Number of connections in use.", func(s *sql.DBStats) float64 { return float64(s.InUse) }},
+		{"db_pool_idle_connections", "gauge", "Number of idle connections.", func(s *sql.DBStats) float64 { return float64(s.Idle) }},
+		{"db_pool_wait_count_total", "counter", "Number of connections waited for.", func(s *sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"db_pool_wait_duration_seconds_total", "counter", "Time blocked waiting for connection.", func(s *sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"db_pool_max_idle_closed_total", "counter", "Connections closed due to max idle.", func(s *sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"db_pool_max_lifetime_closed_total", "counter", "Connections closed due to max lifetime.", func(s *sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	stats := make(map[string]*sql.DBStats)
+	for _, name := range names {
+		if s, ok := p.Dbs[name].Stats(); ok {
+			stats[name] = &s
+		}
+	}
+	for _, m := range metrics {
+		w.header(m.name, m.kind, m.help)
+		for _, name := range names {
+			if s, ok := stats[name]; ok {
+				w.value(m.name, labels("db", name), m.value(s))
+			}
+		}
+	}
+}
+
+// redis.PoolStats of opened clients, label db is 'default' or index of /redis/db/:db
+func (p *Metrics) writeRedis(w *metricsWriter) {
+	if p.Redis == nil {
+		return
+	}
+	stats := p.Redis.PoolStats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.header("redis_pool_hits_total", "counter", "Number of times free connection was found in the pool.")
+	for _, name := range names {
+		w.value("redis_pool_hits_total", labels("db", name), float64(stats[name].Hits))
+	}
+	w.header("redis_pool_misses_total", "counter", "Number of times free connection was not found in the pool.")
+	for _, name := range names {
+		w.value("redis_pool_misses_total", labels("db", name), float64(stats[name].Misses))
+	}
+	w.header("redis_pool_timeouts_total", "counter", "Number of times a wait timeout occurred.")
+	for _, name := range names {
+		w.value("redis_pool_timeouts_total", labels("db", name), float64(stats[name].Timeouts))
+	}
+	w.header("redis_pool_total_connections", "gauge", "Number of total connections in the pool.")
+	for _, name := range names {
+		w.value("redis_pool_total_connections", labels("db", name), float64(stats[name].TotalConns))
+	}
+	w.header("redis_pool_idle_connections", "gauge", "Number of idle connections in the pool.")
+	for _, name := range names {
+		w.value("redis_pool_idle_connections", labels("db", name), float64(stats[name].IdleConns))
+	}
+	w.header("redis_pool_stale_connections_total", "counter", "Number of stale connections removed from the pool.")
+	for _, name := range names {
+		w.value("redis_pool_stale_connections_total", labels("db", name), float64(stats[name].StaleConns))
+	}
+}
+
+func (p *Metrics) writeCache(w *metricsWriter) {
+	hits, misses := cacheHits.Load(), cacheMisses.Load()
+	w.header("cache_hits_total", "counter", "Number of cache hits of Mycache.")
+	w.value("cache_hits_total", "", float64(hits))
+	w.header("cache_misses_total", "counter", "Number of cache misses of Mycache.")
+	w.value("cache_misses_total", "", float64(misses))
+	w.header("cache_hit_ratio", "gauge", "Ratio of cache hits of Mycache since start.")
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	w.value("cache_hit_ratio", "", ratio)
+	if p.Cache != nil {
+		w.header("cache_items", "gauge", "Number of items in Mycache.")
+		w.value("cache_items", "", float64(p.Cache.ItemCount()))
+	}
+}
+
+// gauges of cpu, memory, load and filesystems, and counters of disk and network io
+func (p *Metrics) writeHost(w *metricsWriter) {
+	var sample HostSample
+	ok := false
+	if p.Sampler != nil {
+		sample, ok = p.Sampler.Latest()
+	}
+	if !ok { // cpu percent since the last scrape
+		if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+			sample.CpuPercent = percents[0]
+		}
+		if v, err := mem.VirtualMemory(); err == nil {
+			sample.MemTotal, sample.MemAvailable, sample.MemUsedPercent = v.Total, v.Available, v.UsedPercent
+		}
+		if avg, err := load.Avg(); err == nil {
+			sample.Load1, sample.Load5, sample.Load15 = avg.Load1, avg.Load5, avg.Load15
+		}
+	}
+
+	w.header("host_cpu_usage_percent", "gauge", "Cpu usage percent of all cpus.")
+	w.value("host_cpu_usage_percent", "", sample.CpuPercent)
+	if n, err := cpu.Counts(true); err == nil {
+		w.header("host_cpu_count", "gauge", "Number of logical cpus.")
+		w.value("host_cpu_count", "", float64(n))
+	}
+	w.header("host_memory_total_bytes", "gauge", "Total memory.")
+	w.value("host_memory_total_bytes", "", float64(sample.MemTotal))
+	w.header("host_memory_available_bytes", "gauge", "Available memory.")
+	w.value("host_memory_available_bytes", "", float64(sample.MemAvailable))
+	w.header("host_memory_used_percent", "gauge", "Used percent of memory.")
+	w.value("host_memory_used_percent", "", sample.MemUsedPercent)
+	w.header("host_load1", "gauge", "Load average of 1 minute.")
+	w.value("host_load1", "", sample.Load1)
+	w.header("host_load5", "gauge", "Load average of 5 minutes.")
+	w.value("host_load5", "", sample.Load5)
+	w.header("host_load15", "gauge", "Load average of 15 minutes.")
+	w.value("host_load15", "", sample.Load15)
+	if uptime, err := host.Uptime(); err == nil {
+		w.header("host_uptime_seconds", "gauge", "Seconds since boot.")
+		w.value("host_uptime_seconds", "", float64(uptime))
+	}
+
+	diskBytes, netBytes := diskCounters(), netCounters()
+	w.header("host_disk_read_bytes_total", "counter", "Bytes read of disks.")
+	w.value("host_disk_read_bytes_total", "", float64(diskBytes[0]))
+	w.header("host_disk_written_bytes_total", "counter", "Bytes written of disks.")
+	w.value("host_disk_written_bytes_total", "", float64(diskBytes[1]))
+	w.header("host_network_receive_bytes_total", "counter", "Bytes received of network interfaces except loopback.")
+	w.value("host_network_receive_bytes_total", "", float64(netBytes[0]))
+	w.header("host_network_transmit_bytes_total", "counter", "Bytes sent of network interfaces except loopback.")
+	w.value("host_network_transmit_bytes_total", "", float64(netBytes[1]))
+
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		log.Warnf("get disk partitions failed: %v", err)
+		return
+	}
+	usages := make([]*disk.UsageStat, 0, len(partitions))
+	for _, partition := range partitions {
+		if usage, err := disk.Usage(partition.Mountpoint); err == nil && usage.Total > 0 {
+			usages = append(usages, usage)
+		}
+	}
+	w.header("host_filesystem_size_bytes", "gauge", "Size of filesystem.")
+	for _, u := range usages {
+		w.value("host_filesystem_size_bytes", labels("mountpoint", u.Path, "fstype", u.Fstype), float64(u.Total))
+	}
+	w.header("host_filesystem_free_bytes", "gauge", "Free bytes of filesystem.")
+	for _, u := range usages {
+		w.value("host_filesystem_free_bytes", labels("mountpoint", u.Path, "fstype", u.Fstype), float64(u.Free))
+	}
+	w.header("host_filesystem_used_percent", "gauge", "Used percent of filesystem.")
+	for _, u := range usages {
+		w.value("host_filesystem_used_percent", labels("mountpoint", u.Path, "fstype", u.Fstype), u.UsedPercent)
+	}
+}
+
+func (p *Metrics) writeRuntime(w *metricsWriter) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	w.header("go_goroutines", "gauge", "Number of goroutines.")
+	w.value("go_goroutines", "", float64(runtime.NumGoroutine()))
+	w.header("go_memstats_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	w.value("go_memstats_heap_alloc_bytes", "", float64(m.HeapAlloc))
+	w.header("go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	w.value("go_memstats_sys_bytes", "", float64(m.Sys))
+	w.header("go_gc_cycles_total", "counter", "Number of completed GC cycles.")
+	w.value("go_gc_cycles_total", "", float64(m.NumGC))
+	w.header("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+	w.value("process_start_time_seconds", "", float64(START_TIME.Unix()))
+}
+
+// writer of Prometheus text format
+type metricsWriter struct {
+	strings.Builder
+}
+
+func (w *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *metricsWriter) value(name, labels string, v float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, formatFloat(v))
+}
+
+// labels of pairs such as labels("db", "mysql") is {db="mysql"}
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], replacer.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+	"github.com/minio/minio-go/v7/pkg/notification"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	log "github.com/sirupsen/logrus"
+)
+
+// GET /minio/bucket/:bucket/versioning
+func (p *MinioHandler) versioningHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	cfg, err := p.cli.GetBucketVersioning(ctx, bucket)
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(fiber.Map{
+		"status":            cfg.Status, // empty is never enabled
+		"mfa_delete":        cfg.MFADelete,
+		"excluded_prefixes": cfg.ExcludedPrefixes,
+		"exclude_folders":   cfg.ExcludeFolders,
+	})
+}
+
+// PUT /minio/bucket/:bucket/versioning, body is {"status": "Enabled|Suspended"}
+func (p *MinioHandler) setVersioningHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	req := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	if req.Status != "Enabled" && req.Status != "Suspended" {
+		return fiber.NewError(fiber.StatusBadRequest, "status should be Enabled or Suspended")
+	}
+
+	return p.adminOp(c, "set_versioning", bucket, req, func(ctx context.Context) error {
+		return p.cli.SetBucketVersioning(ctx, bucket, minio.BucketVersioningConfiguration{Status: req.Status})
+	})
+}
+
+// GET /minio/bucket/:bucket/lifecycle
+func (p *MinioHandler) lifecycleHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	cfg, err := p.cli.GetBucketLifecycle(ctx, bucket)
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(cfg)
+}
+
+// PUT /minio/bucket/:bucket/lifecycle, body is LifecycleConfiguration of S3 in xml, or the same in json
+// such as {"Rules": [{"ID": "expire-logs", "Status": "Enabled", "Prefix": "logs/", "Expiration": {"Days": 30}}]}
+func (p *MinioHandler) setLifecycleHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	cfg := lifecycle.NewConfiguration()
+	if err := decodeConfig(c.Body(), cfg); err != nil {
+		return err
+	}
+
+	return p.adminOp(c, "set_lifecycle", bucket, cfg, func(ctx context.Context) error {
+		return p.cli.SetBucketLifecycle(ctx, bucket, cfg)
+	})
+}
+
+// DELETE /minio/bucket/:bucket/lifecycle
+func (p *MinioHandler) deleteLifecycleHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	return p.adminOp(c, "delete_lifecycle", bucket, nil, func(ctx context.Context) error {
+		return p.cli.SetBucketLifecycle(ctx, bucket, lifecycle.NewConfiguration()) // empty config is removed
+	})
+}
+
+// GET /minio/bucket/:bucket/policy, policy json of bucket
+func (p *MinioHandler) policyHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	policy, err := p.cli.GetBucketPolicy(ctx, bucket)
+	if err != nil {
+		return minioError(err)
+	}
+	if policy == "" {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("bucket '%s' has no policy", bucket))
+	}
+	c.Response().Header.Set("Content-Type", "application/json")
+	return c.SendString(policy)
+}
+
+// PUT /minio/bucket/:bucket/policy, body is policy json
+func (p *MinioHandler) setPolicyHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	policy := string(c.Body())
+	if !json.Valid(c.Body()) {
+		return fiber.NewError(fiber.StatusBadRequest, "body should be policy json")
+	}
+
+	return p.adminOp(c, "set_policy", bucket, json.RawMessage(policy), func(ctx context.Context) error {
+		return p.cli.SetBucketPolicy(ctx, bucket, policy)
+	})
+}
+
+// DELETE /minio/bucket/:bucket/policy
+func (p *MinioHandler) deletePolicyHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	return p.adminOp(c, "delete_policy", bucket, nil, func(ctx context.Context) error {
+		return p.cli.SetBucketPolicy(ctx, bucket, "")
+	})
+}
+
+// GET /minio/bucket/:bucket/tags
+func (p *MinioHandler) bucketTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	t, err := p.cli.GetBucketTagging(ctx, bucket)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchTagSet" {
+			return c.JSON(map[string]string{})
+		}
+		return minioError(err)
+	}
+	return c.JSON(t.ToMap())
+}
+
+// PUT /minio/bucket/:bucket/tags, body is {"key": "value"}, replace all tags
+func (p *MinioHandler) setBucketTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	m := make(map[string]string)
+	if err := json.Unmarshal(c.Body(), &m); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	t, err := tags.MapToBucketTags(m)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return p.adminOp(c, "set_tags", bucket, m, func(ctx context.Context) error {
+		return p.cli.SetBucketTagging(ctx, bucket, t)
+	})
+}
+
+// DELETE /minio/bucket/:bucket/tags
+func (p *MinioHandler) deleteBucketTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	return p.adminOp(c, "delete_tags", bucket, nil, func(ctx context.Context) error {
+		return p.cli.RemoveBucketTagging(ctx, bucket)
+	})
+}
+
+// GET /minio/bucket/:bucket/object-tags/*?version_id=
+func (p *MinioHandler) objectTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	t, err := p.cli.GetObjectTagging(ctx, bucket, object, minio.GetObjectTaggingOptions{VersionID: c.Query("version_id")})
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(t.ToMap())
+}
+
+// PUT /minio/bucket/:bucket/object-tags/*?version_id=, body is {"key": "value"}, replace all tags
+func (p *MinioHandler) setObjectTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	m := make(map[string]string)
+	if err := json.Unmarshal(c.Body(), &m); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	t, err := tags.MapToObjectTags(m)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	versionId := c.Query("version_id")
+
+	return p.adminOp(c, "set_object_tags", bucket+"/"+object, fiber.Map{"tags": m, "version_id": versionId},
+		func(ctx context.Context) error {
+			return p.cli.PutObjectTagging(ctx, bucket, object, t, minio.PutObjectTaggingOptions{VersionID: versionId})
+		})
+}
+
+// DELETE /minio/bucket/:bucket/object-tags/*?version_id=
+func (p *MinioHandler) deleteObjectTagsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	versionId := c.Query("version_id")
+
+	return p.adminOp(c, "delete_object_tags", bucket+"/"+object, fiber.Map{"version_id": versionId},
+		func(ctx context.Context) error {
+			return p.cli.RemoveObjectTagging(ctx, bucket, object, minio.RemoveObjectTaggingOptions{VersionID: versionId})
+		})
+}
+
+// GET /minio/bucket/:bucket/retention/*?version_id=, bucket should be created with object locking
+func (p *MinioHandler) retentionHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	mode, until, err := p.cli.GetObjectRetention(ctx, bucket, object, c.Query("version_id"))
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(fiber.Map{"mode": mode, "retain_until": until})
+}
+
+// PUT /minio/bucket/:bucket/retention/*?version_id=
+// body is {"mode": "GOVERNANCE|COMPLIANCE", "retain_until": "2030-01-01T00:00:00Z", "bypass_governance": false}
+func (p *MinioHandler) setRetentionHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	req := struct {
+		Mode             string    `json:"mode"`
+		RetainUntil      time.Time `json:"retain_until"`
+		BypassGovernance bool      `json:"bypass_governance"`
+	}{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	mode := minio.RetentionMode(req.Mode)
+	if !mode.IsValid() {
+		return fiber.NewError(fiber.StatusBadRequest, "mode should be GOVERNANCE or COMPLIANCE")
+	}
+	if !req.RetainUntil.After(time.Now()) {
+		return fiber.NewError(fiber.StatusBadRequest, "retain_until should be in the future")
+	}
+	opts := minio.PutObjectRetentionOptions{
+		GovernanceBypass: req.BypassGovernance,
+		Mode:             &mode,
+		RetainUntilDate:  &req.RetainUntil,
+		VersionID:        c.Query("version_id"),
+	}
+
+	return p.adminOp(c, "set_retention", bucket+"/"+object, fiber.Map{"retention": req, "version_id": opts.VersionID},
+		func(ctx context.Context) error {
+			return p.cli.PutObjectRetention(ctx, bucket, object, opts)
+		})
+}
+
+// GET /minio/bucket/:bucket/legal-hold/*?version_id=
+func (p *MinioHandler) legalHoldHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	status, err := p.cli.GetObjectLegalHold(ctx, bucket, object, minio.GetObjectLegalHoldOptions{VersionID: c.Query("version_id")})
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(fiber.Map{"status": status})
+}
+
+// PUT /minio/bucket/:bucket/legal-hold/*?version_id=, body is {"status": "ON|OFF"}
+func (p *MinioHandler) setLegalHoldHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	req := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	status := minio.LegalHoldStatus(req.Status)
+	if !status.IsValid() {
+		return fiber.NewError(fiber.StatusBadRequest, "status should be ON or OFF")
+	}
+	opts := minio.PutObjectLegalHoldOptions{VersionID: c.Query("version_id"), Status: &status}
+
+	return p.adminOp(c, "set_legal_hold", bucket+"/"+object, fiber.Map{"status": status, "version_id": opts.VersionID},
+		func(ctx context.Context) error {
+			return p.cli.PutObjectLegalHold(ctx, bucket, object, opts)
+		})
+}
+
+// GET /minio/bucket/:bucket/object-lock, default retention of bucket
+func (p *MinioHandler) objectLockHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	enabled, mode, validity, unit, err := p.cli.GetObjectLockConfig(ctx, bucket)
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(fiber.Map{"object_lock": enabled, "mode": mode, "validity": validity, "unit": unit})
+}
+
+// PUT /minio/bucket/:bucket/object-lock, body is {"mode": "GOVERNANCE|COMPLIANCE", "validity": 30, "unit": "DAYS|YEARS"}.
+// empty mode removes default retention.
+func (p *MinioHandler) setObjectLockHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	req := struct {
+		Mode     string `json:"mode"`
+		Validity uint   `json:"validity"`
+		Unit     string `json:"unit"`
+	}{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+
+	var mode *minio.RetentionMode
+	var validity *uint
+	var unit *minio.ValidityUnit
+	if req.Mode != "" {
+		m, u := minio.RetentionMode(req.Mode), minio.ValidityUnit(req.Unit)
+		if !m.IsValid() || (u != minio.Days && u != minio.Years) || req.Validity == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "mode should be GOVERNANCE or COMPLIANCE, unit should be DAYS or YEARS, validity > 0")
+		}
+		mode, validity, unit = &m, &req.Validity, &u
+	}
+
+	return p.adminOp(c, "set_object_lock", bucket, req, func(ctx context.Context) error {
+		return p.cli.SetObjectLockConfig(ctx, bucket, mode, validity, unit)
+	})
+}
+
+// GET /minio/bucket/:bucket/notification
+func (p *MinioHandler) notificationHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	cfg, err := p.cli.GetBucketNotification(ctx, bucket)
+	if err != nil {
+		return minioError(err)
+	}
+	return c.JSON(fiber.Map{
+		"LambdaConfigs": cfg.LambdaConfigs,
+		"TopicConfigs":  cfg.TopicConfigs,
+		"QueueConfigs":  cfg.QueueConfigs,
+	})
+}
+
+// PUT /minio/bucket/:bucket/notification, body is NotificationConfiguration of S3 in xml, or the same in json
+// such as {"QueueConfigs": [{"Queue": "arn:minio:sqs::1:webhook", "Events": ["s3:ObjectCreated:*"]}]}
+func (p *MinioHandler) setNotificationHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	cfg := notification.Configuration{}
+	if err := decodeConfig(c.Body(), &cfg); err != nil {
+		return err
+	}
+
+	return p.adminOp(c, "set_notification", bucket, json.RawMessage(c.Body()), func(ctx context.Context) error {
+		return p.cli.SetBucketNotification(ctx, bucket, cfg)
+	})
+}
+
+// DELETE /minio/bucket/:bucket/notification
+func (p *MinioHandler) deleteNotificationHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	return p.adminOp(c, "delete_notification", bucket, nil, func(ctx context.Context) error {
+		return p.cli.RemoveAllBucketNotification(ctx, bucket)
+	})
+}
+
+// GET /minio/bucket/:bucket/versions?prefix=&max-keys=1000
+// all versions and delete markers of objects, the latest version first per object
+func (p *MinioHandler) versionsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	prefix := c.Query("prefix")
+	maxKeys := fiber.Query(c, "max-keys", MINIO_MAX_KEYS)
+	if maxKeys <= 0 || maxKeys > MINIO_MAX_KEYS {
+		maxKeys = MINIO_MAX_KEYS
+	}
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	versions := make([]fiber.Map, 0)
+	truncated := false
+	for object := range p.cli.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix: prefix, Recursive: true, WithVersions: true}) {
+		if object.Err != nil {
+			log.Errorf("ListObjects versions '%s/%s' failed: %v", bucket, prefix, object.Err)
+			return minioError(object.Err)
+		}
+		if len(versions) >= maxKeys {
+			truncated = true
+			break
+		}
+		versions = append(versions, fiber.Map{
+			"key":              object.Key,
+			"version_id":       object.VersionID,
+			"is_latest":        object.IsLatest,
+			"is_delete_marker": object.IsDeleteMarker,
+			"size":             object.Size,
+			"last_modified":    object.LastModified,
+			"etag":             object.ETag,
+		})
+	}
+
+	return c.JSON(fiber.Map{"bucket": bucket, "prefix": prefix, "versions": versions, "is_truncated": truncated})
+}
+
+// POST /minio/bucket/:bucket/restore?object=&version_id=
+// restore previous version by copying it to be the latest version
+func (p *MinioHandler) restoreVersionHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := c.Query("object")
+	versionId := c.Query("version_id")
+	if object == "" || versionId == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "query object and version_id are required")
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	// no timeout of copy, large object is copied by parts
+	info, err := p.cli.ComposeObject(context.Background(),
+		minio.CopyDestOptions{Bucket: bucket, Object: object},
+		minio.CopySrcOptions{Bucket: bucket, Object: object, VersionID: versionId})
+	detail := fiber.Map{"version_id": versionId, "new_version_id": info.VersionID}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", "restore_version", bucket+"/"+object, detail)
+	if err != nil {
+		log.Errorf("restore '%s/%s' version '%s' failed: %v", bucket, object, versionId, err)
+		return minioError(err)
+	}
+
+	return c.JSON(info)
+}
+
+// client and context with MinioConfig.Timeout
+func (p *MinioHandler) minioContext() (context.Context, context.CancelFunc, error) {
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return nil, nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	return ctx, cancel, nil
+}
+
+// run write operation of bucket administration, then write audit log and response
+func (p *MinioHandler) adminOp(c fiber.Ctx, action, target string, detail interface{},
+	fn func(ctx context.Context) error) error {
+
+	ctx, cancel, err := p.minioContext()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	err = fn(ctx)
+	m := fiber.Map{"detail": detail}
+	if err != nil {
+		m["error"] = err.Error()
+	}
+	auditLog(c, "minio", action, target, m)
+	if err != nil {
+		log.Errorf("minio %s '%s' failed: %v", action, target, err)
+		return minioError(err)
+	}
+
+	return c.JSON(fiber.Map{"target": target, "action": action, "ok": true})
+}
+
+// decode config body of xml as S3 api, or json
+func decodeConfig(body []byte, v interface{}) error {
+	body = bytes.TrimSpace(body)
+	var err error
+	if bytes.HasPrefix(body, []byte("<")) {
+		err = xml.Unmarshal(body, v)
+	} else {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid config body: "+err.Error())
+	}
+	return nil
+}
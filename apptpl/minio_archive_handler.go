@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MINIO_ARCHIVE_MAX_OBJECTS = 10000 // default max objects of archive
+	MINIO_ARCHIVE_MAX_SIZE    = 10240 // default max MB of objects in archive
+)
+
+// GET /minio/bucket/:bucket/archive?prefix=reports/2024/&format=zip|tar.gz
+// stream objects of prefix into archive of response without temp file, name in archive is relative to prefix.
+// objects are listed first, 413 if more than MinioConfig.ArchiveMaxObjects or ArchiveMaxSize.
+// error after streaming is started can only be logged, the archive is truncated.
+func (p *MinioHandler) archiveHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	prefix := c.Query("prefix")
+	format := c.Query("format", "zip")
+	if format != "zip" && format != "tar.gz" {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("format '%s' not supported, should be zip or tar.gz", format))
+	}
+	maxObjects := p.Minioconfig.ArchiveMaxObjects
+	if maxObjects <= 0 {
+		maxObjects = MINIO_ARCHIVE_MAX_OBJECTS
+	}
+	maxSize := p.Minioconfig.ArchiveMaxSize
+	if maxSize <= 0 {
+		maxSize = MINIO_ARCHIVE_MAX_SIZE
+	}
+	maxSize *= 1024 * 1024
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	objects := make([]minio.ObjectInfo, 0)
+	var size int64
+	for object := range p.cli.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			log.Errorf("ListObjects '%s/%s' failed: %v", bucket, prefix, object.Err)
+			return minioError(object.Err)
+		}
+		if strings.HasSuffix(object.Key, "/") { // directory marker
+			continue
+		}
+		objects = append(objects, object)
+		size += object.Size
+		if len(objects) > maxObjects || size > maxSize {
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+				fmt.Sprintf("archive is limited to %d objects and %d MB", maxObjects, maxSize/1024/1024))
+		}
+	}
+	if len(objects) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("no object of prefix '%s'", prefix))
+	}
+
+	name := strings.Trim(path.Base(strings.TrimSuffix(prefix, "/")), "/.")
+	if name == "" {
+		name = bucket
+	}
+	filename := name + "." + format
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+			strings.ReplaceAll(filename, `"`, ""), url.PathEscape(filename)))
+	if format == "zip" {
+		c.Set(fiber.HeaderContentType, "application/zip")
+	} else {
+		c.Set(fiber.HeaderContentType, "application/gzip")
+	}
+
+	conn := c.RequestCtx().Conn()
+	remote := c.IP()
+	log.Infof("archive %d objects, %d bytes of '%s/%s' to %s", len(objects), size, bucket, prefix, remote)
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		start := time.Now()
+		var err error
+		if format == "zip" {
+			err = p.writeZip(w, conn, bucket, prefix, objects)
+		} else {
+			err = p.writeTarGz(w, conn, bucket, prefix, objects)
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Errorf("archive '%s/%s' to %s failed: %v", bucket, prefix, remote, err)
+			return
+		}
+		log.Infof("archive '%s/%s' to %s done, elapsed %v", bucket, prefix, remote, time.Since(start))
+	})
+}
+
+func (p *MinioHandler) writeZip(w io.Writer, conn net.Conn, bucket, prefix string, objects []minio.ObjectInfo) error {
+	zw := zip.NewWriter(w)
+	for _, object := range objects {
+		header := &zip.FileHeader{
+			Name:     archiveName(prefix, object.Key),
+			Method:   zip.Deflate,
+			Modified: object.LastModified,
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err = p.archiveObject(fw, conn, bucket, object); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (p *MinioHandler) writeTarGz(w io.Writer, conn net.Conn, bucket, prefix string, objects []minio.ObjectInfo) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, object := range objects {
+		header := &tar.Header{
+			Name:    archiveName(prefix, object.Key),
+			Mode:    0644,
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := p.archiveObject(tw, conn, bucket, object); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// name in archive relative to prefix, base name when prefix is the object itself
+func archiveName(prefix, key string) string {
+	name := strings.TrimLeft(key[len(prefix):], "/")
+	if name == "" {
+		return path.Base(key)
+	}
+	return name
+}
+
+// copy content of object to archive. etag is matched so that size in tar header is right,
+// object changed after listing fails the archive.
+func (p *MinioHandler) archiveObject(w io.Writer, conn net.Conn, bucket string, object minio.ObjectInfo) error {
+	opts := minio.GetObjectOptions{}
+	opts.SetMatchETag(object.ETag)
+	fd, err := p.cli.GetObject(context.Background(), bucket, object.Key, opts)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	n, err := io.Copy(w, &deadlineReader{ReadCloser: fd, conn: conn})
+	if err != nil {
+		return fmt.Errorf("object '%s': %w", object.Key, err)
+	}
+	if n != object.Size {
+		return fmt.Errorf("object '%s' size %d is changed to %d", object.Key, object.Size, n)
+	}
+	return nil
+}
@@ -6,19 +6,39 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"mime"
+	"net"
+	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	MINIO_MAX_KEYS      = 1000             // max objects per page of listing
+	MINIO_WRITE_TIMEOUT = 60 * time.Second // max time of writing a block of download
+	MINIO_READ_TIMEOUT  = 60 * time.Second // max time of reading a block of upload
+)
+
 type MinioHandler struct {
 	Minioconfig *MinioConfig
+	Jobs        *JobManager // background jobs such as delete objects of prefix
+	Mycache     *cache.Cache
 	cli         *minio.Client
+	presignCli  *minio.Client // client of MinioConfig.PublicAddr to sign url
+
+	usageJobs  map[string]*Job // running usage scan of bucket and prefix
+	usageMutex sync.Mutex
 }
 
 // r := app.Group("/minio")
@@ -29,9 +49,51 @@ func (p *MinioHandler) AddRouter(r fiber.Router) error {
 	r.Get("/", p.homeHandler)
 	r.Get("/buckets", p.bucketsHandler)
 	r.Get("/bucket/:bucket/objects", p.objectsHandler)
-	r.Get("/bucket/:bucket/object-meta/:object", p.objectInfoHandler)
-	r.Get("/bucket/:bucket/object/:object", p.objectHandler)
-	// r.Head("/bucket/:bucket/object/:object", objectInfoHander)
+	r.Get("/bucket/:bucket/object-meta/*", p.objectInfoHandler)
+	r.Get("/bucket/:bucket/object/*", p.objectHandler)
+	r.Get("/bucket/:bucket/object-preview/*", p.previewHandler)
+	r.Get("/bucket/:bucket/object-thumbnail/*", p.thumbnailHandler)
+	r.Get("/bucket/:bucket/presign", p.presignHandler)
+	r.Get("/bucket/:bucket/usage", p.usageHandler)
+	r.Get("/bucket/:bucket/archive", p.archiveHandler)
+	r.Post("/bucket/:bucket/presign-post", adminOnly, p.presignPostHandler)
+
+	// bucket administration, write operations are admin role only
+	r.Get("/bucket/:bucket/versioning", p.versioningHandler)
+	r.Put("/bucket/:bucket/versioning", adminOnly, p.setVersioningHandler)
+	r.Get("/bucket/:bucket/versions", p.versionsHandler)
+	r.Post("/bucket/:bucket/restore", adminOnly, p.restoreVersionHandler)
+	r.Get("/bucket/:bucket/lifecycle", p.lifecycleHandler)
+	r.Put("/bucket/:bucket/lifecycle", adminOnly, p.setLifecycleHandler)
+	r.Delete("/bucket/:bucket/lifecycle", adminOnly, p.deleteLifecycleHandler)
+	r.Get("/bucket/:bucket/policy", p.policyHandler)
+	r.Put("/bucket/:bucket/policy", adminOnly, p.setPolicyHandler)
+	r.Delete("/bucket/:bucket/policy", adminOnly, p.deletePolicyHandler)
+	r.Get("/bucket/:bucket/tags", p.bucketTagsHandler)
+	r.Put("/bucket/:bucket/tags", adminOnly, p.setBucketTagsHandler)
+	r.Delete("/bucket/:bucket/tags", adminOnly, p.deleteBucketTagsHandler)
+	r.Get("/bucket/:bucket/notification", p.notificationHandler)
+	r.Put("/bucket/:bucket/notification", adminOnly, p.setNotificationHandler)
+	r.Delete("/bucket/:bucket/notification", adminOnly, p.deleteNotificationHandler)
+	r.Get("/bucket/:bucket/object-lock", p.objectLockHandler)
+	r.Put("/bucket/:bucket/object-lock", adminOnly, p.setObjectLockHandler)
+	r.Get("/bucket/:bucket/object-tags/*", p.objectTagsHandler)
+	r.Put("/bucket/:bucket/object-tags/*", adminOnly, p.setObjectTagsHandler)
+	r.Delete("/bucket/:bucket/object-tags/*", adminOnly, p.deleteObjectTagsHandler)
+	r.Get("/bucket/:bucket/retention/*", p.retentionHandler)
+	r.Put("/bucket/:bucket/retention/*", adminOnly, p.setRetentionHandler)
+	r.Get("/bucket/:bucket/legal-hold/*", p.legalHoldHandler)
+	r.Put("/bucket/:bucket/legal-hold/*", adminOnly, p.setLegalHoldHandler)
+
+	// write operations, admin role only
+	r.Put("/bucket/:bucket", adminOnly, p.makeBucketHandler)
+	r.Delete("/bucket/:bucket", adminOnly, p.removeBucketHandler)
+	r.Put("/bucket/:bucket/object/*", adminOnly, p.putObjectHandler)
+	r.Delete("/bucket/:bucket/object/*", adminOnly, p.deleteObjectHandler)
+	r.Delete("/bucket/:bucket/objects", adminOnly, p.deleteObjectsHandler)
+	r.Post("/bucket/:bucket/copy", adminOnly, p.copyObjectHandler)
+	r.Post("/bucket/:bucket/move", adminOnly, p.copyObjectHandler)
+	r.Post("/sync", adminOnly, p.syncHandler)
 
 	return nil
 }
@@ -41,9 +103,36 @@ func (p *MinioHandler) homeHandler(c fiber.Ctx) error {
 	c.Response().Header.Set("Content-Type", "text/html")
 	c.WriteString(`<html><body><h1>Minio Information</h1>
 	<a href="/minio/buckets?mime=json">buckets</a><br>
-	<a href="/minio/bucket/:bucket/objects">/bucket/:bucket/objects</a><br>
-	<a href="/minio/bucket/:bucket/object-meta/:object">/bucket/:bucket/object-meta/:object</a><br>
-	<a href="/minio/bucket/:bucket/object/:object">/bucket/:bucket/object/:object</a><br>
+	<a href="/minio/bucket/:bucket/objects">/bucket/:bucket/objects?prefix=&delimiter=/&start-after=&max-keys=1000</a><br>
+	<a href="/minio/bucket/:bucket/object-meta/*">/bucket/:bucket/object-meta/*</a><br>
+	<a href="/minio/bucket/:bucket/object/*">/bucket/:bucket/object/*?version_id=&inline=false</a> (support Range, If-None-Match, If-Modified-Since)<br>
+	<a href="/minio/bucket/:bucket/object-preview/*">/bucket/:bucket/object-preview/*?rows=20&sheet=</a> (first rows of .xlsx, .csv, .json or paragraphs of .docx)<br>
+	<a href="/minio/bucket/:bucket/object-thumbnail/*">/bucket/:bucket/object-thumbnail/*?size=256</a> (jpeg, png, gif)<br>
+	<a href="/minio/bucket/:bucket/archive">/bucket/:bucket/archive?prefix=&format=zip|tar.gz</a> (download objects of prefix as archive)<br>
+	<a href="/minio/bucket/:bucket/usage">/bucket/:bucket/usage?prefix=&depth=1&refresh=false&mime=json|excel</a> (background job, cached 1 hour)<br>
+	<a href="/minio/bucket/:bucket/presign">/bucket/:bucket/presign?object=&method=GET|PUT&expires=3600&inline=false</a> (PUT is admin only)<br>
+	<h2>Bucket administration</h2>
+	<a href="/minio/bucket/:bucket/versioning">/bucket/:bucket/versioning</a> PUT {"status": "Enabled|Suspended"}<br>
+	<a href="/minio/bucket/:bucket/versions">/bucket/:bucket/versions?prefix=&max-keys=1000</a><br>
+	POST /bucket/:bucket/restore?object=&version_id=<br>
+	<a href="/minio/bucket/:bucket/lifecycle">/bucket/:bucket/lifecycle</a> PUT|DELETE, xml or json<br>
+	<a href="/minio/bucket/:bucket/policy">/bucket/:bucket/policy</a> PUT|DELETE<br>
+	<a href="/minio/bucket/:bucket/tags">/bucket/:bucket/tags</a> PUT|DELETE {"key": "value"}<br>
+	<a href="/minio/bucket/:bucket/notification">/bucket/:bucket/notification</a> PUT|DELETE, xml or json<br>
+	<a href="/minio/bucket/:bucket/object-lock">/bucket/:bucket/object-lock</a> PUT {"mode": "GOVERNANCE", "validity": 30, "unit": "DAYS"}<br>
+	<a href="/minio/bucket/:bucket/object-tags/*">/bucket/:bucket/object-tags/*?version_id=</a> PUT|DELETE<br>
+	<a href="/minio/bucket/:bucket/retention/*">/bucket/:bucket/retention/*?version_id=</a> PUT {"mode": "COMPLIANCE", "retain_until": "2030-01-01T00:00:00Z"}<br>
+	<a href="/minio/bucket/:bucket/legal-hold/*">/bucket/:bucket/legal-hold/*?version_id=</a> PUT {"status": "ON|OFF"}<br>
+	<h2>Admin only</h2>
+	PUT /bucket/:bucket?region=&object_locking=false<br>
+	DELETE /bucket/:bucket?force=false<br>
+	POST /bucket/:bucket/presign-post {"key_prefix": "upload/", "expires": 3600, "max_size": 10485760, "content_type_prefix": "image/"}<br>
+	PUT /bucket/:bucket/object/* (request body is content of object)<br>
+	DELETE /bucket/:bucket/object/*?version_id=<br>
+	DELETE /bucket/:bucket/objects (body ["a.txt", "dir/b.txt"]), or ?prefix=dir/ (background job)<br>
+	POST /bucket/:bucket/copy?object=&to_bucket=&to=<br>
+	POST /bucket/:bucket/move?object=&to_bucket=&to=<br>
+	POST /sync {"source": {"bucket": "reports", "prefix": "2024/"}, "target": {"dir": "backup/reports"}, "dry_run": true, "delete": false, "include": ["*.csv"], "exclude": []} (background job)<br>
 	</body></html>`)
 	return nil
 }
@@ -76,9 +165,24 @@ func (p *MinioHandler) bucketsHandler(c fiber.Ctx) error {
 	return c.Send(data)
 }
 
-// GET /minio/bucket/:bucket/objects
+// GET /minio/bucket/:bucket/objects?prefix=dir/&delimiter=/&start-after=&max-keys=1000
+// list objects of prefix page by page. with delimiter '/', objects of sub folders are
+// grouped into prefixes like folders, else all objects under prefix are listed recursively.
+// next page begins from next_start_after when is_truncated.
 func (p *MinioHandler) objectsHandler(c fiber.Ctx) error {
 	log.Debug("/minio/bucket/:bucket/objects")
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	prefix := c.Query("prefix")
+	delimiter := c.Query("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		return fiber.NewError(fiber.StatusBadRequest, "delimiter should be '/' or empty")
+	}
+	startAfter := c.Query("start-after")
+	maxKeys := fiber.Query(c, "max-keys", MINIO_MAX_KEYS)
+	if maxKeys <= 0 || maxKeys > MINIO_MAX_KEYS {
+		maxKeys = MINIO_MAX_KEYS
+	}
+
 	if p.cli == nil {
 		if err := p.getMinioClient(); err != nil {
 			return err
@@ -86,39 +190,65 @@ func (p *MinioHandler) objectsHandler(c fiber.Ctx) error {
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
-	defer cancel()
+	defer cancel() // stop listing when page is full
 
-	objectCh := p.cli.ListObjects(ctx, c.Params("bucket"),
+	objectCh := p.cli.ListObjects(ctx, bucket,
 		minio.ListObjectsOptions{
-			Prefix:    "",
-			Recursive: true,
+			Prefix:     prefix,
+			Recursive:  delimiter == "",
+			StartAfter: startAfter,
+			MaxKeys:    maxKeys,
 		})
 
-	c.Response().Header.Set("Content-Type", "application/json")
-	c.WriteString("[")
-	i := 0
+	objects := make([]fiber.Map, 0)
+	prefixes := make([]string, 0)
+	truncated := false
+	last := ""
 	for object := range objectCh {
 		if object.Err != nil {
-			log.Errorf("ListObjects failed: %v", object.Err)
-			return c.SendString(object.Err.Error())
+			log.Errorf("ListObjects '%s/%s' failed: %v", bucket, prefix, object.Err)
+			return minioError(object.Err)
 		}
-		if i > 0 {
-			c.WriteString(`, `)
+		if len(objects)+len(prefixes) >= maxKeys {
+			truncated = true
+			break
 		}
-		log.Println(object.Key)
-		c.Writef(`"%s" `, strings.Replace(object.Key, `"`, `\"`, -1))
-		i++
+		last = object.Key
+		if delimiter != "" && strings.HasSuffix(object.Key, delimiter) && object.ETag == "" {
+			prefixes = append(prefixes, object.Key) // common prefix as folder
+			// keys such as 'dir/a' are after 'dir/' and roll up into it again,
+			// so next page starts after all keys of the prefix
+			last = object.Key + string(utf8.MaxRune)
+			continue
+		}
+		objects = append(objects, fiber.Map{
+			"key":           object.Key,
+			"size":          object.Size,
+			"last_modified": object.LastModified,
+			"etag":          object.ETag,
+			"storage_class": object.StorageClass,
+		})
 	}
-	c.WriteString(` ]`)
 
-	return nil
+	m := fiber.Map{
+		"bucket":       bucket,
+		"prefix":       prefix,
+		"delimiter":    delimiter,
+		"objects":      objects,
+		"prefixes":     prefixes,
+		"is_truncated": truncated,
+	}
+	if truncated {
+		m["next_start_after"] = last
+	}
+	return c.JSON(m)
 }
 
-// GET /minio/bucket/:bucket/object-meta/:object?mime=json|xml
+// GET /minio/bucket/:bucket/object-meta/*?mime=json|xml
 func (p *MinioHandler) objectInfoHandler(c fiber.Ctx) error {
-	log.Debug("/minio/bucket/:bucket/object/:object")
+	log.Debug("/minio/bucket/:bucket/object-meta/*")
 	bucket, _ := url.QueryUnescape(c.Params("bucket"))
-	object, _ := url.QueryUnescape(c.Params("object"))
+	object := objectParam(c)
 	// q := c.Queries()
 	// mime := "json"
 	// if len(q["mime"]) > 0 {
@@ -159,11 +289,14 @@ func (p *MinioHandler) objectInfoHandler(c fiber.Ctx) error {
 	}
 }
 
-// GET /minio/bucket/:bucket/object/:object
+// GET /minio/bucket/:bucket/object/*?version_id=&inline=false
+// support Range of single byte range for video seeking and resumable download,
+// If-None-Match and If-Modified-Since with 304, and inline to show in browser.
 func (p *MinioHandler) objectHandler(c fiber.Ctx) error {
-	log.Debug("/minio/bucket/:bucket/object/:object")
+	log.Debug("/minio/bucket/:bucket/object/*")
 	bucket, _ := url.QueryUnescape(c.Params("bucket"))
-	object, _ := url.QueryUnescape(c.Params("object"))
+	object := objectParam(c)
+	versionId := c.Query("version_id")
 
 	if p.cli == nil {
 		if err := p.getMinioClient(); err != nil {
@@ -174,21 +307,146 @@ func (p *MinioHandler) objectHandler(c fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
 	defer cancel()
 
-	object_fd, err := p.cli.GetObject(ctx, bucket, object,
-		minio.GetObjectOptions{})
+	info, err := p.cli.StatObject(ctx, bucket, object, minio.StatObjectOptions{VersionID: versionId})
 	if err != nil {
-		c.Writef("bucket: '%s', object: '%s', ", bucket, object)
-		c.WriteString(err.Error())
+		log.Errorf("StatObject '%s/%s' failed: %v", bucket, object, err)
+		return minioError(err)
+	}
+
+	etag := `"` + info.ETag + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, info.LastModified.UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if notModified(c, etag, info.LastModified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	contentType := info.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		if t := mime.TypeByExtension(path.Ext(object)); t != "" {
+			contentType = t
+		}
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	disposition := "attachment"
+	if fiber.Query(c, "inline", false) {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentDisposition,
+		fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition,
+			strings.ReplaceAll(path.Base(object), `"`, ""), url.PathEscape(path.Base(object))))
+
+	opts := minio.GetObjectOptions{VersionID: versionId}
+	length := info.Size
+	status := fiber.StatusOK
+	// If-Range with other etag means object is changed, send whole object
+	if rng := c.Get(fiber.HeaderRange); rng != "" && (c.Get(fiber.HeaderIfRange) == "" || c.Get(fiber.HeaderIfRange) == etag) {
+		start, end, ok := parseRange(rng, info.Size)
+		if !ok {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", info.Size))
+			return fiber.NewError(fiber.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("invalid range '%s'", rng))
+		}
+		if start >= 0 {
+			opts.SetRange(start, end)
+			length = end - start + 1
+			status = fiber.StatusPartialContent
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size))
+		}
+	}
+	c.Status(status)
+	if c.Method() == fiber.MethodHead || length == 0 {
+		c.Response().Header.SetContentLength(int(length))
+		c.Response().SkipBody = c.Method() == fiber.MethodHead
 		return nil
 	}
-	defer object_fd.Close()
 
-	// set response header of Attachment
-	// => Content-Disposition: attachment; filename=object
-	// => Content-Type: image/png
-	c.Attachment(object)
-	_, err = io.Copy(c, object_fd)
-	return err
+	// download is not limited by MinioConfig.Timeout, object is closed after response is sent
+	object_fd, err := p.cli.GetObject(context.Background(), bucket, object, opts)
+	if err != nil {
+		log.Errorf("GetObject '%s/%s' failed: %v", bucket, object, err)
+		return minioError(err)
+	}
+	c.Response().SetBodyStream(&deadlineReader{ReadCloser: object_fd, conn: c.RequestCtx().Conn()}, int(length))
+	return nil
+}
+
+// check If-None-Match and If-Modified-Since, If-Modified-Since is ignored when If-None-Match is set
+func notModified(c fiber.Ctx, etag string, modified time.Time) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(c.Get(fiber.HeaderIfModifiedSince)); err == nil {
+		return !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// parse single range such as 'bytes=0-99', 'bytes=100-' and 'bytes=-100'.
+// multiple ranges are not supported, start is -1 to send whole object.
+// return false when range is not satisfiable.
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return -1, -1, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return -1, -1, true
+	}
+
+	var start, end int64
+	var err error
+	if first == "" { // suffix range of last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		start, end = max(size-n, 0), size-1
+	} else {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+			return 0, 0, false
+		}
+		end = size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil {
+				return 0, 0, false
+			}
+			end = min(end, size-1)
+		}
+	}
+	if start < 0 || start >= size || start > end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// WriteTimeout of server is deadline of whole response, extend it when reading body
+// so that large download is limited by speed instead of total time
+type deadlineReader struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (r *deadlineReader) Read(b []byte) (int, error) {
+	r.conn.SetWriteDeadline(time.Now().Add(MINIO_WRITE_TIMEOUT))
+	return r.ReadCloser.Read(b)
+}
+
+// body stream of upload, read deadline is extended on each read instead of ReadTimeout of server
+type readDeadlineReader struct {
+	io.Reader
+	conn net.Conn
+}
+
+func (r *readDeadlineReader) Read(b []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(MINIO_READ_TIMEOUT))
+	return r.Reader.Read(b)
 }
 
 func (p *MinioHandler) getMinioClient() error {
@@ -197,6 +455,7 @@ func (p *MinioHandler) getMinioClient() error {
 		&minio.Options{
 			Creds:  credentials.NewStaticV4(p.Minioconfig.User, p.Minioconfig.Password, ""),
 			Secure: p.Minioconfig.Ssl,
+			Region: p.Minioconfig.Region,
 		})
 	if err != nil {
 		log.Errorf("connect minio '%s' failed: %v", p.Minioconfig.Addr, err)
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MINIO_PRESIGN_EXPIRES     = 3600          // default seconds of presigned url
+	MINIO_PRESIGN_MAX_EXPIRES = 7 * 24 * 3600 // max seconds of presigned url by S3
+)
+
+// body of POST /minio/bucket/:bucket/presign-post
+type presignPostRequest struct {
+	Key               string `json:"key"`        // exact object name, or
+	KeyPrefix         string `json:"key_prefix"` // object name should start with
+	Expires           int    `json:"expires"`    // seconds
+	MinSize           int64  `json:"min_size"`
+	MaxSize           int64  `json:"max_size"`
+	ContentType       string `json:"content_type"`
+	ContentTypePrefix string `json:"content_type_prefix"` // such as 'image/'
+}
+
+// GET /minio/bucket/:bucket/presign?object=&method=GET|PUT&expires=3600&inline=false
+// return presigned url so that browser can download or upload object directly from minio.
+// PUT is admin role only.
+func (p *MinioHandler) presignHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := c.Query("object")
+	if object == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "object is required")
+	}
+	method := c.Query("method", "GET")
+	expires, err := presignExpires(fiber.Query(c, "expires", MINIO_PRESIGN_EXPIRES))
+	if err != nil {
+		return err
+	}
+	cli, err := p.presignClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	var u *url.URL
+	switch method {
+	case "GET":
+		params := url.Values{}
+		if fiber.Query(c, "inline", false) {
+			params.Set("response-content-disposition", "inline")
+		} else {
+			params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(object)))
+		}
+		u, err = cli.PresignedGetObject(ctx, bucket, object, expires, params)
+	case "PUT":
+		if role, _ := c.Locals("role").(string); role != "admin" {
+			return fiber.NewError(fiber.StatusForbidden, "admin role is required")
+		}
+		u, err = cli.PresignedPutObject(ctx, bucket, object, expires)
+		auditLog(c, "minio", "presign_put", bucket+"/"+object, fiber.Map{"expires": expires.Seconds()})
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("method '%s' not supported, should be GET or PUT", method))
+	}
+	if err != nil {
+		log.Errorf("presign %s '%s/%s' failed: %v", method, bucket, object, err)
+		return minioError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"method":     method,
+		"url":        u.String(),
+		"expires_at": time.Now().Add(expires),
+	})
+}
+
+// POST /minio/bucket/:bucket/presign-post, body is presignPostRequest, admin role only.
+// return url and form data of POST policy, browser upload by multipart form with the form data and field 'file'.
+// size and content type of upload are limited by policy.
+func (p *MinioHandler) presignPostHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	req := presignPostRequest{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	if (req.Key == "") == (req.KeyPrefix == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "one of key and key_prefix is required")
+	}
+	if req.Expires == 0 {
+		req.Expires = MINIO_PRESIGN_EXPIRES
+	}
+	expires, err := presignExpires(req.Expires)
+	if err != nil {
+		return err
+	}
+
+	policy := minio.NewPostPolicy()
+	err = policy.SetBucket(bucket)
+	if err == nil && req.Key != "" {
+		err = policy.SetKey(req.Key)
+	}
+	if err == nil && req.KeyPrefix != "" {
+		err = policy.SetKeyStartsWith(req.KeyPrefix)
+	}
+	if err == nil {
+		err = policy.SetExpires(time.Now().UTC().Add(expires))
+	}
+	if err == nil && req.MaxSize > 0 {
+		err = policy.SetContentLengthRange(req.MinSize, req.MaxSize)
+	}
+	if err == nil && req.ContentType != "" {
+		err = policy.SetContentType(req.ContentType)
+	}
+	if err == nil && req.ContentTypePrefix != "" {
+		err = policy.SetContentTypeStartsWith(req.ContentTypePrefix)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	cli, err := p.presignClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	u, formData, err := cli.PresignedPostPolicy(ctx, policy)
+	if err != nil {
+		log.Errorf("presign post policy of bucket '%s' failed: %v", bucket, err)
+		return minioError(err)
+	}
+	auditLog(c, "minio", "presign_post", bucket, req)
+
+	return c.JSON(fiber.Map{
+		"url":        u.String(),
+		"form_data":  formData,
+		"expires_at": time.Now().Add(expires),
+	})
+}
+
+func presignExpires(seconds int) (time.Duration, error) {
+	if seconds <= 0 || seconds > MINIO_PRESIGN_MAX_EXPIRES {
+		return 0, fiber.NewError(fiber.StatusBadRequest,
+			fmt.Sprintf("expires should be 1 to %d seconds", MINIO_PRESIGN_MAX_EXPIRES))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// client to sign url with MinioConfig.PublicAddr, which browser can access.
+// signing is local, region is set so that bucket location is not requested.
+func (p *MinioHandler) presignClient() (*minio.Client, error) {
+	if p.Minioconfig.PublicAddr == "" {
+		if p.cli == nil {
+			if err := p.getMinioClient(); err != nil {
+				return nil, err
+			}
+		}
+		return p.cli, nil
+	}
+	if p.presignCli != nil {
+		return p.presignCli, nil
+	}
+
+	region := p.Minioconfig.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	cli, err := minio.New(p.Minioconfig.PublicAddr,
+		&minio.Options{
+			Creds:  credentials.NewStaticV4(p.Minioconfig.User, p.Minioconfig.Password, ""),
+			Secure: p.Minioconfig.PublicSsl,
+			Region: region,
+		})
+	if err != nil {
+		log.Errorf("new minio client of public addr '%s' failed: %v", p.Minioconfig.PublicAddr, err)
+		return nil, err
+	}
+	p.presignCli = cli
+	return cli, nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gomutex/godocx/packager"
+	"github.com/gomutex/godocx/wml/ctypes"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	MINIO_PREVIEW_ROWS       = 20               // default rows or paragraphs of preview
+	MINIO_PREVIEW_MAX_ROWS   = 1000             // max rows or paragraphs of preview
+	MINIO_PREVIEW_MAX_SIZE   = 50 * 1024 * 1024 // max size of xlsx, docx and image which are read into memory
+	MINIO_THUMBNAIL_SIZE     = 256              // default max width and height of thumbnail
+	MINIO_THUMBNAIL_MAX_SIZE = 1024
+	MINIO_IMAGE_MAX_PIXELS   = 50 * 1000 * 1000 // larger image is not decoded
+)
+
+// GET /minio/bucket/:bucket/object-preview/*?rows=20&sheet=
+// parse the first rows of .xlsx, .csv, .json, or paragraphs of .docx and return json,
+// so that uploaded file can be inspected without download. sheet of xlsx default the first one.
+func (p *MinioHandler) previewHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	rows := fiber.Query(c, "rows", MINIO_PREVIEW_ROWS)
+	if rows <= 0 || rows > MINIO_PREVIEW_MAX_ROWS {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("rows should be 1 to %d", MINIO_PREVIEW_MAX_ROWS))
+	}
+	ext := strings.ToLower(path.Ext(object))
+	switch ext {
+	case ".xlsx", ".docx", ".csv", ".json":
+	default:
+		return fiber.NewError(fiber.StatusUnsupportedMediaType,
+			fmt.Sprintf("preview of '%s' not supported, should be .xlsx, .docx, .csv or .json", ext))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	fd, info, err := p.openObject(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	result := fiber.Map{"bucket": bucket, "object": object, "size": info.Size, "type": ext[1:]}
+	switch ext {
+	case ".xlsx":
+		err = previewXlsx(fd, info.Size, c.Query("sheet"), rows, result)
+	case ".docx":
+		err = previewDocx(fd, info.Size, rows, result)
+	case ".csv":
+		err = previewCsv(fd, rows, result)
+	case ".json":
+		err = previewJson(fd, rows, result)
+	}
+	if err != nil {
+		log.Errorf("preview '%s/%s' failed: %v", bucket, object, err)
+		return err
+	}
+
+	return c.JSON(result)
+}
+
+// GET /minio/bucket/:bucket/object-thumbnail/*?size=256
+// thumbnail of jpeg, png and gif, size is max width and height. png is kept for transparency, others are jpeg.
+func (p *MinioHandler) thumbnailHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	size := fiber.Query(c, "size", MINIO_THUMBNAIL_SIZE)
+	if size <= 0 || size > MINIO_THUMBNAIL_MAX_SIZE {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("size should be 1 to %d", MINIO_THUMBNAIL_MAX_SIZE))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	fd, info, err := p.openObject(ctx, bucket, object)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// thumbnail is changed only when object is changed
+	etag := fmt.Sprintf(`"%s-%d"`, info.ETag, size)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	if notModified(c, etag, info.LastModified) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	if info.Size > MINIO_PREVIEW_MAX_SIZE {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+			fmt.Sprintf("image larger than %d MB is not supported", MINIO_PREVIEW_MAX_SIZE/1024/1024))
+	}
+	data, err := io.ReadAll(fd)
+	if err != nil {
+		return minioError(err)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "not jpeg, png or gif image: "+err.Error())
+	}
+	if cfg.Width*cfg.Height > MINIO_IMAGE_MAX_PIXELS {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+			fmt.Sprintf("image %dx%d is too large", cfg.Width, cfg.Height))
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Errorf("decode image '%s/%s' failed: %v", bucket, object, err)
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error())
+	}
+
+	buf := new(bytes.Buffer)
+	thumb := thumbnail(img, size)
+	if format == "png" {
+		c.Set(fiber.HeaderContentType, "image/png")
+		err = png.Encode(buf, thumb)
+	} else {
+		c.Set(fiber.HeaderContentType, "image/jpeg")
+		err = jpeg.Encode(buf, thumb, &jpeg.Options{Quality: 80})
+	}
+	if err != nil {
+		return err
+	}
+	return c.Send(buf.Bytes())
+}
+
+// GetObject and stat of it, error of not found is returned by stat
+func (p *MinioHandler) openObject(ctx context.Context, bucket, object string) (*minio.Object, minio.ObjectInfo, error) {
+	if object == "" {
+		return nil, minio.ObjectInfo{}, fiber.NewError(fiber.StatusBadRequest, "object name is required")
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return nil, minio.ObjectInfo{}, err
+		}
+	}
+	fd, err := p.cli.GetObject(ctx, bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, minioError(err)
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, minio.ObjectInfo{}, minioError(err)
+	}
+	return fd, info, nil
+}
+
+// rows of sheet, read by iterator and stop at rows
+func previewXlsx(r io.Reader, size int64, sheet string, rows int, result fiber.Map) error {
+	if size > MINIO_PREVIEW_MAX_SIZE {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+			fmt.Sprintf("xlsx larger than %d MB is not supported", MINIO_PREVIEW_MAX_SIZE/1024/1024))
+	}
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid xlsx: "+err.Error())
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if sheet == "" && len(sheets) > 0 {
+		sheet = sheets[0]
+	}
+	it, err := f.Rows(sheet)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("sheet '%s' not found", sheet))
+	}
+	defer it.Close()
+
+	list := make([][]string, 0)
+	truncated := false
+	for it.Next() {
+		if len(list) >= rows {
+			truncated = true
+			break
+		}
+		cols, err := it.Columns()
+		if err != nil {
+			return err
+		}
+		list = append(list, cols)
+	}
+	result["sheets"] = sheets
+	result["sheet"] = sheet
+	result["rows"] = list
+	result["truncated"] = truncated
+	return nil
+}
+
+// text and style of paragraphs, tables are skipped since cells are not exported by godocx
+func previewDocx(r io.Reader, size int64, rows int, result fiber.Map) error {
+	if size > MINIO_PREVIEW_MAX_SIZE {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge,
+			fmt.Sprintf("docx larger than %d MB is not supported", MINIO_PREVIEW_MAX_SIZE/1024/1024))
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return minioError(err)
+	}
+	doc, err := packager.Unpack(&data)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid docx: "+err.Error())
+	}
+
+	paragraphs := make([]fiber.Map, 0)
+	tables := 0
+	truncated := false
+	if doc.Document != nil && doc.Document.Body != nil {
+		for _, child := range doc.Document.Body.Children {
+			if child.Table != nil {
+				tables++
+			}
+			if child.Para == nil {
+				continue
+			}
+			if len(paragraphs) >= rows {
+				truncated = true
+				break
+			}
+			ct := child.Para.GetCT()
+			para := fiber.Map{"text": paragraphText(ct.Children)}
+			if ct.Property != nil && ct.Property.Style != nil {
+				para["style"] = ct.Property.Style.Val
+			}
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	result["paragraphs"] = paragraphs
+	result["tables"] = tables
+	result["truncated"] = truncated
+	return nil
+}
+
+// text of runs and hyperlinks of paragraph
+func paragraphText(children []ctypes.ParagraphChild) string {
+	var sb strings.Builder
+	for _, child := range children {
+		if child.Link != nil {
+			sb.WriteString(paragraphText(child.Link.Children))
+		}
+		if child.Run == nil {
+			continue
+		}
+		for _, rc := range child.Run.Children {
+			switch {
+			case rc.Text != nil:
+				sb.WriteString(rc.Text.Text)
+			case rc.Tab != nil:
+				sb.WriteString("\t")
+			case rc.Break != nil:
+				sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// the first rows of csv, only the read part of object is downloaded
+func previewCsv(r io.Reader, rows int, result fiber.Map) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	list := make([][]string, 0)
+	truncated := false
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid csv: "+err.Error())
+		}
+		if len(list) >= rows {
+			truncated = true
+			break
+		}
+		list = append(list, record)
+	}
+	result["rows"] = list
+	result["truncated"] = truncated
+	return nil
+}
+
+// the first items of json array, or the whole json value which is not array
+func previewJson(r io.Reader, rows int, result fiber.Map) error {
+	br := bufio.NewReader(io.LimitReader(r, MINIO_PREVIEW_MAX_SIZE))
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+
+	// skip BOM and white space to find out whether it is array
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	var first byte
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid json: "+err.Error())
+		}
+		if first = b[0]; bytes.IndexByte([]byte(" \t\r\n"), first) < 0 {
+			break
+		}
+		br.Discard(1)
+	}
+	if first != '[' {
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid json: "+err.Error())
+		}
+		result["value"] = value
+		return nil
+	}
+
+	if _, err := dec.Token(); err != nil { // [
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid json: "+err.Error())
+	}
+	items := make([]interface{}, 0)
+	truncated := false
+	for dec.More() {
+		if len(items) >= rows {
+			truncated = true
+			break
+		}
+		var item interface{}
+		if err := dec.Decode(&item); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "invalid json: "+err.Error())
+		}
+		items = append(items, item)
+	}
+	result["items"] = items
+	result["truncated"] = truncated
+	return nil
+}
+
+// scale image down to fit size x size, each pixel is average of samples in its area.
+// image smaller than size is not scaled.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	const samples = 4 // samples per axis of each area
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			var r, g, b, a, n uint32
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + (y1-y0)*sy/samples
+				for sx := 0; sx < samples; sx++ {
+					px := x0 + (x1-x0)*sx/samples
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r, g, b, a, n = r+cr, g+cg, b+cb, a+ca, n+1
+				}
+			}
+			// average of premultiplied color to non-premultiplied
+			c := color.NRGBA64{A: uint16(a / n)}
+			if a > 0 {
+				c.R, c.G, c.B = uint16(uint64(r)*0xffff/uint64(a)), uint16(uint64(g)*0xffff/uint64(a)), uint16(uint64(b)*0xffff/uint64(a))
+			}
+			thumb.Set(x, y, c)
+		}
+	}
+	return thumb
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MINIO_SYNC_MAX_ERRORS  = 100  // errors kept in result of sync job
+	MINIO_SYNC_MAX_ACTIONS = 1000 // actions listed in result of dry run
+)
+
+// bucket prefix, or directory relative to MinioConfig.SyncDir
+type syncLocation struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+	Dir    string `json:"dir"`
+}
+
+func (l syncLocation) String() string {
+	if l.Dir != "" {
+		return "dir:" + l.Dir
+	}
+	return l.Bucket + "/" + l.Prefix
+}
+
+// body of POST /minio/sync
+type syncRequest struct {
+	Source  syncLocation `json:"source"`
+	Target  syncLocation `json:"target"`
+	DryRun  bool         `json:"dry_run"`
+	Delete  bool         `json:"delete"`  // delete files of target which are not in source
+	Include []string     `json:"include"` // patterns of path.Match, such as '*.csv' or '2024/*'
+	Exclude []string     `json:"exclude"`
+}
+
+// object or file, key is relative to prefix or directory with '/' separator
+type syncEntry struct {
+	Key      string
+	Size     int64
+	ETag     string // empty of local file, md5 is computed when it is needed
+	Modified time.Time
+}
+
+type syncResult struct {
+	Total   int64       `json:"total"` // entries of source after filter
+	Copied  int64       `json:"copied"`
+	Skipped int64       `json:"skipped"` // the same of target
+	Deleted int64       `json:"deleted"`
+	Failed  int64       `json:"failed"`
+	Bytes   int64       `json:"bytes"`
+	DryRun  bool        `json:"dry_run"`
+	Actions []string    `json:"actions,omitempty"` // of dry run, such as 'copy a.txt'
+	Errors  []fiber.Map `json:"errors,omitempty"`
+}
+
+// POST /minio/sync, body is syncRequest, admin role only
+// mirror bucket prefix to local directory or another bucket prefix, or local directory to bucket prefix.
+// file is copied when size or ETag is different, files of target not in source are deleted with 'delete'.
+// runs in background job, progress is in /jobs/:id.
+// {"source": {"bucket": "reports", "prefix": "2024/"}, "target": {"dir": "backup/reports"}, "dry_run": true}
+func (p *MinioHandler) syncHandler(c fiber.Ctx) error {
+	req := syncRequest{}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	if err := p.checkLocation(&req.Source); err != nil {
+		return err
+	}
+	if err := p.checkLocation(&req.Target); err != nil {
+		return err
+	}
+	if req.Source.Dir != "" && req.Target.Dir != "" {
+		return fiber.NewError(fiber.StatusBadRequest, "sync between local directories is not supported")
+	}
+	if req.Source.Bucket != "" && req.Source.Bucket == req.Target.Bucket &&
+		(strings.HasPrefix(req.Source.Prefix, req.Target.Prefix) || strings.HasPrefix(req.Target.Prefix, req.Source.Prefix)) {
+		return fiber.NewError(fiber.StatusBadRequest, "source and target are overlapped")
+	}
+	for _, pattern := range append(req.Include, req.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid pattern '%s'", pattern))
+		}
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	target := req.Source.String() + " -> " + req.Target.String()
+	auditLog(c, "minio", "sync", target, req)
+	job := p.Jobs.Start(c, "minio_sync", target, func(ctx context.Context, job *Job) (interface{}, error) {
+		result, err := p.sync(ctx, job, &req)
+		if err == nil && result.Failed > 0 {
+			err = fmt.Errorf("%d files failed to sync", result.Failed)
+		}
+		return result, err
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(job.info())
+}
+
+// location should be bucket or directory, directory is resolved to absolute path under SyncDir
+func (p *MinioHandler) checkLocation(l *syncLocation) error {
+	if (l.Bucket == "") == (l.Dir == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "one of bucket and dir is required of source and target")
+	}
+	if l.Dir == "" {
+		// prefix is a directory, 'a' is the same as 'a/'
+		if l.Prefix != "" && !strings.HasSuffix(l.Prefix, "/") {
+			l.Prefix += "/"
+		}
+		return nil
+	}
+	if p.Minioconfig.SyncDir == "" {
+		return fiber.NewError(fiber.StatusForbidden, "sync of local directory is disabled, sync_dir is not set")
+	}
+	root, err := filepath.Abs(p.Minioconfig.SyncDir)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(root, filepath.FromSlash(l.Dir))
+	if !isUnderDir(root, dir) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("dir '%s' is not under sync_dir", l.Dir))
+	}
+	l.Dir = dir
+	return nil
+}
+
+// path is dir itself or under dir, both are cleaned
+func isUnderDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// local file of key under dir. key such as '../a' which other S3 than minio accepts is rejected,
+// so that sync never writes or deletes files out of dir.
+func syncFile(dir, key string) (string, error) {
+	name := filepath.Join(dir, filepath.FromSlash(key))
+	if name == filepath.Clean(dir) || !isUnderDir(dir, name) {
+		return "", fmt.Errorf("key '%s' is out of dir '%s'", key, dir)
+	}
+	return name, nil
+}
+
+func (p *MinioHandler) sync(ctx context.Context, job *Job, req *syncRequest) (*syncResult, error) {
+	result := &syncResult{DryRun: req.DryRun}
+	job.SetProgress(0, 0, "listing source and target")
+	// missing source is not empty, or all of target is deleted
+	if req.Source.Dir != "" {
+		if _, err := os.Stat(req.Source.Dir); err != nil {
+			return result, err
+		}
+	}
+	sources, err := p.listLocation(ctx, req.Source)
+	if err != nil {
+		return result, err
+	}
+	targets, err := p.listLocation(ctx, req.Target)
+	if err != nil {
+		return result, err
+	}
+
+	keys := make([]string, 0, len(sources))
+	for key := range sources {
+		if syncMatch(key, req.Include, req.Exclude) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	extraneous := make([]string, 0)
+	if req.Delete {
+		for key := range targets {
+			// excluded files of target are kept
+			if _, ok := sources[key]; !ok && syncMatch(key, req.Include, req.Exclude) {
+				extraneous = append(extraneous, key)
+			}
+		}
+		sort.Strings(extraneous)
+	}
+	result.Total = int64(len(keys))
+	total := int64(len(keys) + len(extraneous))
+
+	fail := func(key string, err error) {
+		log.Errorf("sync '%s' failed: %v", key, err)
+		result.Failed++
+		if len(result.Errors) < MINIO_SYNC_MAX_ERRORS {
+			result.Errors = append(result.Errors, fiber.Map{"key": key, "error": err.Error()})
+		}
+	}
+	action := func(s string) {
+		if len(result.Actions) < MINIO_SYNC_MAX_ACTIONS {
+			result.Actions = append(result.Actions, s)
+		}
+	}
+
+	for i, key := range keys {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		job.SetProgress(int64(i), total, "copy "+key)
+		src := sources[key]
+		if dst, ok := targets[key]; ok && p.sameEntry(req, src, dst) {
+			result.Skipped++
+			continue
+		}
+		if req.DryRun {
+			action("copy " + key)
+			result.Copied++
+			result.Bytes += src.Size
+			continue
+		}
+		if err := p.copyEntry(ctx, req, src); err != nil {
+			fail(key, err)
+			continue
+		}
+		result.Copied++
+		result.Bytes += src.Size
+	}
+
+	for i, key := range extraneous {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		job.SetProgress(int64(len(keys)+i), total, "delete "+key)
+		if req.DryRun {
+			action("delete " + key)
+			result.Deleted++
+			continue
+		}
+		if err := p.deleteEntry(ctx, req.Target, key); err != nil {
+			fail(key, err)
+			continue
+		}
+		result.Deleted++
+	}
+	job.SetProgress(total, total, "")
+
+	return result, nil
+}
+
+// include is all when it is empty, exclude is checked after include.
+// pattern matches key such as '2024/*.csv' or base name such as '*.csv'
+func syncMatch(key string, include, exclude []string) bool {
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, key); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, path.Base(key)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(include) > 0 && !match(include) {
+		return false
+	}
+	return !match(exclude)
+}
+
+func (p *MinioHandler) listLocation(ctx context.Context, l syncLocation) (map[string]syncEntry, error) {
+	entries := make(map[string]syncEntry)
+	if l.Dir != "" {
+		err := filepath.WalkDir(l.Dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && name == l.Dir { // target directory is created by sync
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(l.Dir, name)
+			key := filepath.ToSlash(rel)
+			entries[key] = syncEntry{Key: key, Size: info.Size(), Modified: info.ModTime()}
+			return nil
+		})
+		return entries, err
+	}
+
+	for object := range p.cli.ListObjects(ctx, l.Bucket, minio.ListObjectsOptions{Prefix: l.Prefix, Recursive: true}) {
+		if object.Err != nil {
+			log.Errorf("ListObjects '%s' failed: %v", l, object.Err)
+			return nil, object.Err
+		}
+		key := object.Key[len(l.Prefix):]
+		if key == "" || strings.HasSuffix(key, "/") { // directory marker
+			continue
+		}
+		entries[key] = syncEntry{Key: key, Size: object.Size, ETag: object.ETag, Modified: object.LastModified}
+	}
+	return entries, nil
+}
+
+// same size, and same ETag when both are md5. ETag of multipart upload is not md5 of content,
+// so target which is not older than source is the same.
+func (p *MinioHandler) sameEntry(req *syncRequest, src, dst syncEntry) bool {
+	if src.Size != dst.Size {
+		return false
+	}
+	srcEtag, dstEtag := src.ETag, dst.ETag
+	if srcEtag == "" && !strings.Contains(dstEtag, "-") {
+		srcEtag = fileMd5(filepath.Join(req.Source.Dir, filepath.FromSlash(src.Key)))
+	}
+	if dstEtag == "" && !strings.Contains(srcEtag, "-") {
+		dstEtag = fileMd5(filepath.Join(req.Target.Dir, filepath.FromSlash(dst.Key)))
+	}
+	if srcEtag != "" && dstEtag != "" && !strings.Contains(srcEtag, "-") && !strings.Contains(dstEtag, "-") {
+		return srcEtag == dstEtag
+	}
+	return !dst.Modified.Before(src.Modified)
+}
+
+// md5 hex of file, empty when failed
+func fileMd5(name string) string {
+	fd, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer fd.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (p *MinioHandler) copyEntry(ctx context.Context, req *syncRequest, src syncEntry) error {
+	srcLoc, dstLoc := req.Source, req.Target
+	switch {
+	case srcLoc.Dir != "":
+		name, err := syncFile(srcLoc.Dir, src.Key)
+		if err != nil {
+			return err
+		}
+		_, err = p.cli.FPutObject(ctx, dstLoc.Bucket, dstLoc.Prefix+src.Key, name,
+			minio.PutObjectOptions{PartSize: MINIO_PART_SIZE})
+		return err
+
+	case dstLoc.Dir != "":
+		// FGetObject downloads to temp file then rename, broken file is never left.
+		// modified time is set as object, so that it is the same at next sync.
+		name, err := syncFile(dstLoc.Dir, src.Key)
+		if err != nil {
+			return err
+		}
+		if err := p.cli.FGetObject(ctx, srcLoc.Bucket, srcLoc.Prefix+src.Key, name, minio.GetObjectOptions{}); err != nil {
+			return err
+		}
+		return os.Chtimes(name, src.Modified, src.Modified)
+
+	default:
+		_, err := p.cli.ComposeObject(ctx,
+			minio.CopyDestOptions{Bucket: dstLoc.Bucket, Object: dstLoc.Prefix + src.Key},
+			minio.CopySrcOptions{Bucket: srcLoc.Bucket, Object: srcLoc.Prefix + src.Key})
+		return err
+	}
+}
+
+func (p *MinioHandler) deleteEntry(ctx context.Context, l syncLocation, key string) error {
+	if l.Dir != "" {
+		name, err := syncFile(l.Dir, key)
+		if err != nil {
+			return err
+		}
+		return os.Remove(name)
+	}
+	return p.cli.RemoveObject(ctx, l.Bucket, l.Prefix+key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sync")
+	tests := []struct {
+		key  string
+		want string // empty of rejected key
+	}{
+		{"a.txt", filepath.Join(dir, "a.txt")},
+		{"2024/01/a.csv", filepath.Join(dir, "2024", "01", "a.csv")},
+		{"a/../b.txt", filepath.Join(dir, "b.txt")},
+		{"/etc/passwd", filepath.Join(dir, "etc", "passwd")},
+		{"..a", filepath.Join(dir, "..a")},
+		{"../a.txt", ""},
+		{"a/../../a.txt", ""},
+		{"../sync2/a.txt", ""},
+		{"..", ""},
+		{".", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		name, err := syncFile(dir, tt.key)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("syncFile(%q) should be rejected, got %s", tt.key, name)
+			}
+		} else if err != nil || name != tt.want {
+			t.Errorf("syncFile(%q) want %s, got %s, %v", tt.key, tt.want, name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+
+	"goapptol/utils"
+)
+
+const (
+	MINIO_USAGE_CACHE = time.Hour // result of usage scan is cached, refresh=true to scan again
+)
+
+// age groups of usage by last modified
+var minioAgeGroups = []struct {
+	name string
+	days int
+}{
+	{"<1d", 1}, {"1-7d", 7}, {"7-30d", 30}, {"30-90d", 90}, {"90-365d", 365}, {">365d", 0},
+}
+
+// objects and size of a group, such as prefix 'team-a/' or content type 'image/png'
+type usageGroup struct {
+	Name    string `json:"name"`
+	Objects int64  `json:"objects"`
+	Size    int64  `json:"size"`
+}
+
+type bucketUsage struct {
+	Bucket        string        `json:"bucket"`
+	Prefix        string        `json:"prefix"`
+	Depth         int           `json:"depth"`
+	Objects       int64         `json:"objects"`
+	Size          int64         `json:"size"`
+	ByPrefix      []*usageGroup `json:"by_prefix"`
+	ByContentType []*usageGroup `json:"by_content_type"`
+	ByAge         []*usageGroup `json:"by_age"`
+	ScanTime      time.Time     `json:"scan_time"`
+	Elapsed       float64       `json:"elapsed"` // seconds of scan
+}
+
+// GET /minio/bucket/:bucket/usage?prefix=&depth=1&refresh=false&mime=json|excel&dest=minio://bucket/prefix/
+// objects and size of bucket group by prefix of depth, content type and age, only the latest versions.
+// scan runs in background job and result is cached for MINIO_USAGE_CACHE,
+// 202 and the job is returned when there is no cached result, GET again after the job is done.
+func (p *MinioHandler) usageHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	prefix := c.Query("prefix")
+	depth := fiber.Query(c, "depth", 1)
+	if depth < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "depth should be greater than 0")
+	}
+	mimetype := c.Query("mime", "json")
+	if mimetype != "json" && mimetype != "excel" {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("mime '%s' not supported", mimetype))
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	key := fmt.Sprintf("minio:usage:%s:%d:%s", bucket, depth, prefix)
+	if !fiber.Query(c, "refresh", false) {
+		if v, ok := cacheGet(p.Mycache, key); ok {
+			if mimetype == "excel" {
+				return p.usageExcel(c, v.(*bucketUsage))
+			}
+			return c.JSON(v)
+		}
+	}
+
+	// the same scan is not started twice
+	p.usageMutex.Lock()
+	defer p.usageMutex.Unlock()
+	if p.usageJobs == nil {
+		p.usageJobs = make(map[string]*Job)
+	}
+	for k, job := range p.usageJobs { // finished jobs are kept by JobManager only
+		if !job.Running() {
+			delete(p.usageJobs, k)
+		}
+	}
+	if job, ok := p.usageJobs[key]; ok {
+		return c.Status(fiber.StatusAccepted).JSON(job.info())
+	}
+
+	target := bucket + "/" + prefix
+	job := p.Jobs.Start(c, "minio_usage", target, func(ctx context.Context, job *Job) (interface{}, error) {
+		usage, err := p.scanUsage(ctx, job, bucket, prefix, depth)
+		if err != nil {
+			return nil, err
+		}
+		p.Mycache.Set(key, usage, MINIO_USAGE_CACHE)
+		return fiber.Map{"objects": usage.Objects, "size": usage.Size, "elapsed": usage.Elapsed}, nil
+	})
+	p.usageJobs[key] = job
+
+	return c.Status(fiber.StatusAccepted).JSON(job.info())
+}
+
+// list all objects of prefix and sum up by groups
+func (p *MinioHandler) scanUsage(ctx context.Context, job *Job, bucket, prefix string, depth int) (*bucketUsage, error) {
+	start := time.Now()
+	usage := &bucketUsage{Bucket: bucket, Prefix: prefix, Depth: depth, ScanTime: start}
+	prefixes := make(map[string]*usageGroup)
+	types := make(map[string]*usageGroup)
+	ages := make([]*usageGroup, len(minioAgeGroups))
+	for i, g := range minioAgeGroups {
+		ages[i] = &usageGroup{Name: g.name}
+	}
+	add := func(groups map[string]*usageGroup, name string, size int64) {
+		g, ok := groups[name]
+		if !ok {
+			g = &usageGroup{Name: name}
+			groups[name] = g
+		}
+		g.Objects++
+		g.Size += size
+	}
+
+	// metadata of listing is extension of minio, content type is guessed by extension without it
+	opts := minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: true}
+	for object := range p.cli.ListObjects(ctx, bucket, opts) {
+		if object.Err != nil {
+			log.Errorf("ListObjects '%s/%s' failed: %v", bucket, prefix, object.Err)
+			return nil, object.Err
+		}
+		usage.Objects++
+		usage.Size += object.Size
+
+		// 'team-a/2024/' of 'team-a/2024/x.log' with depth 2, objects not in sub directory are grouped into prefix
+		parts := strings.Split(object.Key[len(prefix):], "/")
+		group := prefix
+		if len(parts) > 1 {
+			group += strings.Join(parts[:min(depth, len(parts)-1)], "/") + "/"
+		}
+		add(prefixes, group, object.Size)
+		add(types, objectContentType(object), object.Size)
+
+		days := int(start.Sub(object.LastModified).Hours() / 24)
+		for i, g := range minioAgeGroups {
+			if days < g.days || g.days == 0 {
+				ages[i].Objects++
+				ages[i].Size += object.Size
+				break
+			}
+		}
+
+		if usage.Objects%MINIO_MAX_KEYS == 0 {
+			job.SetProgress(usage.Objects, 0, fmt.Sprintf("scanned %d objects, %d bytes", usage.Objects, usage.Size))
+		}
+	}
+	job.SetProgress(usage.Objects, usage.Objects, "")
+
+	usage.ByPrefix = sortGroups(prefixes)
+	usage.ByContentType = sortGroups(types)
+	usage.ByAge = ages
+	usage.Elapsed = time.Since(start).Seconds()
+	return usage, nil
+}
+
+// content type of listing with metadata, or by extension of object name
+func objectContentType(object minio.ObjectInfo) string {
+	contentType := object.ContentType
+	if contentType == "" {
+		contentType = object.UserMetadata["content-type"]
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(object.Key))
+	}
+	contentType, _, _ = strings.Cut(contentType, ";") // without charset
+	if contentType = strings.TrimSpace(contentType); contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+// groups sort by size desc
+func sortGroups(groups map[string]*usageGroup) []*usageGroup {
+	list := make([]*usageGroup, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Size != list[j].Size {
+			return list[i].Size > list[j].Size
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// export usage to excel, a row per group with columns group, name, objects, size
+func (p *MinioHandler) usageExcel(c fiber.Ctx, usage *bucketUsage) error {
+	filename := usage.Bucket + "-usage.xlsx"
+	sheetname := usage.Bucket + " usage"
+
+	ch := make(chan string, 100)
+	go func() {
+		defer close(ch)
+		write := func(group string, list []*usageGroup) {
+			for _, g := range list {
+				b, _ := json.Marshal(fiber.Map{"group": group, "name": g.Name, "objects": g.Objects, "size": g.Size})
+				ch <- string(b)
+			}
+		}
+		write("total", []*usageGroup{{Name: usage.Bucket + "/" + usage.Prefix, Objects: usage.Objects, Size: usage.Size}})
+		write("prefix", usage.ByPrefix)
+		write("content_type", usage.ByContentType)
+		write("age", usage.ByAge)
+	}()
+
+	if err := utils.Json2excel(ch, sheetname, "log/"+filename); err != nil {
+		return err
+	}
+
+	return sendExport(c, p, filename)
+}
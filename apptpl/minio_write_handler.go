@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MINIO_PART_SIZE = 16 * 1024 * 1024 // part size of multipart upload when size is unknown
+)
+
+// PUT /minio/bucket/:bucket/object/*
+// stream request body into object, multipart upload is used for large or chunked body.
+// Content-Type and X-Amz-Meta-* headers are saved to object.
+func (p *MinioHandler) putObjectHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	if object == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "object name is required")
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	// body larger than BodyLimit is not read into memory, with fiber.Config StreamRequestBody
+	var reader io.Reader
+	if stream := c.Request().BodyStream(); stream != nil {
+		reader = &readDeadlineReader{Reader: stream, conn: c.RequestCtx().Conn()}
+	} else {
+		reader = bytes.NewReader(c.Body())
+	}
+	size := int64(c.Request().Header.ContentLength()) // -1 of chunked body
+	if size < -1 {
+		size = -1
+	}
+
+	opts := minio.PutObjectOptions{
+		ContentType:  c.Get(fiber.HeaderContentType, "application/octet-stream"),
+		PartSize:     MINIO_PART_SIZE,
+		UserMetadata: make(map[string]string),
+	}
+	for k, v := range c.GetReqHeaders() {
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") && len(v) > 0 {
+			opts.UserMetadata[k[len("x-amz-meta-"):]] = v[0]
+		}
+	}
+
+	// no timeout of upload, it depends on size of object
+	info, err := p.cli.PutObject(context.Background(), bucket, object, reader, size, opts)
+	if err != nil {
+		log.Errorf("PutObject '%s/%s' failed: %v", bucket, object, err)
+		auditLog(c, "minio", "put", bucket+"/"+object, fiber.Map{"size": size, "error": err.Error()})
+		return minioError(err)
+	}
+	auditLog(c, "minio", "put", bucket+"/"+object, fiber.Map{"size": info.Size, "etag": info.ETag})
+
+	return c.Status(fiber.StatusCreated).JSON(info)
+}
+
+// DELETE /minio/bucket/:bucket/object/*?version_id=
+func (p *MinioHandler) deleteObjectHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := objectParam(c)
+	if object == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "object name is required")
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	versionId := c.Query("version_id")
+	err := p.cli.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: versionId})
+	detail := fiber.Map{"version_id": versionId}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", "delete", bucket+"/"+object, detail)
+	if err != nil {
+		log.Errorf("RemoveObject '%s/%s' failed: %v", bucket, object, err)
+		return minioError(err)
+	}
+
+	return c.JSON(fiber.Map{"bucket": bucket, "object": object, "deleted": true})
+}
+
+// DELETE /minio/bucket/:bucket/objects, body is json array of object names ["a.txt", "dir/b.txt"],
+// or DELETE /minio/bucket/:bucket/objects?prefix=dir/ to delete all objects of prefix in background job.
+func (p *MinioHandler) deleteObjectsHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	prefix := c.Query("prefix")
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	if prefix != "" {
+		target := bucket + "/" + prefix
+		auditLog(c, "minio", "delete_objects", target, nil)
+		job := p.Jobs.Start(c, "minio_delete", target, func(ctx context.Context, job *Job) (interface{}, error) {
+			objectCh := make(chan minio.ObjectInfo)
+			var listErr error // written before objectCh is closed
+			go func() {
+				defer close(objectCh)
+				for object := range p.cli.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+					if object.Err != nil {
+						log.Errorf("ListObjects '%s' failed: %v", target, object.Err)
+						listErr = object.Err
+						return
+					}
+					select {
+					case objectCh <- object:
+						job.AddDone(1)
+					case <-ctx.Done(): // job is canceled
+						listErr = ctx.Err()
+						return
+					}
+				}
+			}()
+			errs := removeObjects(ctx, p.cli, bucket, objectCh)
+			if listErr != nil { // deleted partially
+				return errs, fmt.Errorf("list objects of '%s' failed: %v", target, listErr)
+			}
+			if len(errs) > 0 {
+				return errs, fmt.Errorf("%d objects failed to delete", len(errs))
+			}
+			return nil, nil
+		})
+		return c.Status(fiber.StatusAccepted).JSON(job.info())
+	}
+
+	objects := make([]string, 0)
+	if err := json.Unmarshal(c.Body(), &objects); err != nil || len(objects) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "body should be json array of object names, or set query prefix")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	objectCh := make(chan minio.ObjectInfo, len(objects))
+	for _, object := range objects {
+		objectCh <- minio.ObjectInfo{Key: object}
+	}
+	close(objectCh)
+	errs := removeObjects(ctx, p.cli, bucket, objectCh)
+	auditLog(c, "minio", "delete_objects", bucket, fiber.Map{"objects": objects, "errors": len(errs)})
+
+	result := fiber.Map{"total": len(objects), "deleted": len(objects) - len(errs), "errors": errs}
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusMultiStatus).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// remove objects by batch of DeleteObjects, return errors of objects
+func removeObjects(ctx context.Context, cli *minio.Client, bucket string, objectCh <-chan minio.ObjectInfo) []fiber.Map {
+	errs := make([]fiber.Map, 0)
+	for e := range cli.RemoveObjects(ctx, bucket, objectCh, minio.RemoveObjectsOptions{}) {
+		errs = append(errs, fiber.Map{"object": e.ObjectName, "error": e.Err.Error()})
+	}
+	return errs
+}
+
+// POST /minio/bucket/:bucket/copy?object=a.txt&to_bucket=&to=b.txt&version_id=
+// POST /minio/bucket/:bucket/move?object=a.txt&to_bucket=&to=b.txt&version_id=
+// server side copy, objects larger than 5GiB are copied by multipart. move is copy then delete source,
+// with version_id the version is copied, and removed by move.
+func (p *MinioHandler) copyObjectHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	object := c.Query("object")
+	toBucket := c.Query("to_bucket", bucket)
+	to := c.Query("to")
+	if object == "" || to == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "query object and to are required")
+	}
+	if bucket == toBucket && object == to {
+		return fiber.NewError(fiber.StatusBadRequest, "source and target are the same")
+	}
+	move := strings.HasSuffix(c.Path(), "/move")
+	action := "copy"
+	if move {
+		action = "move"
+	}
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	// no timeout of copy, large object is copied by parts
+	ctx := context.Background()
+	target := toBucket + "/" + to
+	versionId := c.Query("version_id")
+	info, err := p.cli.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: toBucket, Object: to},
+		minio.CopySrcOptions{Bucket: bucket, Object: object, VersionID: versionId})
+	if err == nil && move {
+		// the version moved is removed, not a delete marker of the latest version
+		err = p.cli.RemoveObject(ctx, bucket, object, minio.RemoveObjectOptions{VersionID: versionId})
+	}
+	detail := fiber.Map{"to": target, "version_id": versionId}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", action, bucket+"/"+object, detail)
+	if err != nil {
+		log.Errorf("%s object '%s/%s' to '%s' failed: %v", action, bucket, object, target, err)
+		return minioError(err)
+	}
+
+	return c.JSON(info)
+}
+
+// PUT /minio/bucket/:bucket?region=&object_locking=false
+func (p *MinioHandler) makeBucketHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	opts := minio.MakeBucketOptions{
+		Region:        c.Query("region"),
+		ObjectLocking: fiber.Query(c, "object_locking", false),
+	}
+	err := p.cli.MakeBucket(ctx, bucket, opts)
+	detail := fiber.Map{"region": opts.Region, "object_locking": opts.ObjectLocking}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", "make_bucket", bucket, detail)
+	if err != nil {
+		log.Errorf("MakeBucket '%s' failed: %v", bucket, err)
+		return minioError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"bucket": bucket, "created": true})
+}
+
+// DELETE /minio/bucket/:bucket?force=false, bucket should be empty unless force
+func (p *MinioHandler) removeBucketHandler(c fiber.Ctx) error {
+	bucket, _ := url.QueryUnescape(c.Params("bucket"))
+	force := fiber.Query(c, "force", false)
+	if p.cli == nil {
+		if err := p.getMinioClient(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(p.Minioconfig.Timeout))
+	defer cancel()
+
+	err := p.cli.RemoveBucketWithOptions(ctx, bucket, minio.RemoveBucketOptions{ForceDelete: force})
+	detail := fiber.Map{"force": force}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "minio", "remove_bucket", bucket, detail)
+	if err != nil {
+		log.Errorf("RemoveBucket '%s' failed: %v", bucket, err)
+		return minioError(err)
+	}
+
+	return c.JSON(fiber.Map{"bucket": bucket, "deleted": true})
+}
+
+// object name of wildcard route /object/*, which may contain '/'
+func objectParam(c fiber.Ctx) string {
+	object, _ := url.PathUnescape(c.Params("*"))
+	return object
+}
+
+// convert error response of minio to fiber error with the same status code
+func minioError(err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode >= 400 {
+		return fiber.NewError(resp.StatusCode, resp.Message)
+	}
+	return fiber.NewError(fiber.StatusBadRequest, err.Error())
+}
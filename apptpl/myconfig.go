@@ -16,21 +16,90 @@ type DBConfig struct {
 	MaxIdleConns int      `toml:"maxidleconns" json:"maxidleconns"`
 	MaxIdleTime  string   `toml:"maxidletime" json:"maxidletime"`
 	Dsn          []string `toml:"dsn" json:"dsn"`
+
+	// row write api, default is false means read only
+	Writable      bool   `toml:"writable" json:"writable"`
+	VersionColumn string `toml:"version_column" json:"version_column"` // optimistic lock column
 }
 
 type MinioConfig struct {
-	Addr     string `toml:"addr" json:"addr"`
-	User     string `toml:"user" json:"user"`
-	Password string `toml:"password" json:"-"`
-	Ssl      bool   `toml:"ssl" json:"ssl"`
-	Timeout  uint   `toml:"timeout" json:"timeout"`
+	Addr       string `toml:"addr" json:"addr"`
+	PublicAddr string `toml:"public_addr" json:"public_addr"` // addr in presigned url for browser, default addr
+	PublicSsl  bool   `toml:"public_ssl" json:"public_ssl"`
+	Region     string `toml:"region" json:"region"`
+	User       string `toml:"user" json:"user"`
+	Password   string `toml:"password" json:"-"`
+	Ssl        bool   `toml:"ssl" json:"ssl"`
+	Timeout    uint   `toml:"timeout" json:"timeout"`
+	// limits of archive download of prefix
+	ArchiveMaxObjects int    `toml:"archive_max_objects" json:"archive_max_objects"`
+	ArchiveMaxSize    int64  `toml:"archive_max_size" json:"archive_max_size"` // MB
+	SyncDir           string `toml:"sync_dir" json:"sync_dir"`                 // local directories of sync are under it, empty to disable
 }
 
 type RedisConfig struct {
-	Addr     string `toml:"addr" json:"addr"`
-	Password string `toml:"password" json:"-"`
-	Db       uint   `toml:"db" json:"db"`
-	Timeout  uint   `toml:"timeout" json:"timeout"`
+	Mode             string   `toml:"mode" json:"mode"` // standalone, cluster or sentinel, default standalone
+	Addr             string   `toml:"addr" json:"addr"`
+	Addrs            []string `toml:"addrs" json:"addrs"` // seed nodes of cluster, or addrs of sentinels
+	MasterName       string   `toml:"master_name" json:"master_name"`
+	Password         string   `toml:"password" json:"-"`
+	SentinelPassword string   `toml:"sentinel_password" json:"-"`
+	Db               uint     `toml:"db" json:"db"`
+	Timeout          uint     `toml:"timeout" json:"timeout"`
+	Delimiter        string   `toml:"delimiter" json:"delimiter"` // namespace delimiter of keys, default ':'
+}
+
+// user of api, request with header 'Authorization: Bearer <token>' or 'X-Api-Token: <token>'
+type AuthUser struct {
+	Name  string `toml:"name" json:"name"`
+	Token string `toml:"token" json:"-"`
+	Role  string `toml:"role" json:"role"` // admin or empty
+}
+
+type AuthConfig struct {
+	Users []AuthUser `toml:"users" json:"users"`
+}
+
+type SchemaConfig struct {
+	Enable   bool   `toml:"enable" json:"enable"`
+	Interval string `toml:"interval" json:"interval"` // capture interval, such as "1h"
+	Path     string `toml:"path" json:"path"`         // local directory to save snapshots
+	Keep     int    `toml:"keep" json:"keep"`         // max snapshots per datasource, 0 is unlimited
+}
+
+type SamplerConfig struct {
+	Enable   bool   `toml:"enable" json:"enable"`
+	Interval string `toml:"interval" json:"interval"` // sample interval, such as "10s"
+	Keep     int    `toml:"keep" json:"keep"`         // samples kept in memory
+	Path     string `toml:"path" json:"path"`         // file to save samples, empty is not saved
+}
+
+// alert when value of metric compares with threshold is true for duration 'for'
+type AlertRule struct {
+	Name      string  `toml:"name" json:"name"`
+	Source    string  `toml:"source" json:"source"` // host, mysql, postgresql, clickhouse or redis
+	Metric    string  `toml:"metric" json:"metric"` // such as disk_used_percent, threads_running of mysql, used_memory of redis
+	Path      string  `toml:"path" json:"path"`     // mountpoint of host disk_used_percent, default '/'
+	Query     string  `toml:"query" json:"query"`   // sql returns one number of database source, instead of metric
+	Op        string  `toml:"op" json:"op"`         // >, >=, <, <=, ==, !=
+	Threshold float64 `toml:"threshold" json:"threshold"`
+	For       string  `toml:"for" json:"for"` // such as "5m", empty is firing at once
+	Severity  string  `toml:"severity" json:"severity"`
+}
+
+type AlertSinkConfig struct {
+	Type    string `toml:"type" json:"type"`       // webhook, log or redis
+	Url     string `toml:"url" json:"url"`         // url of webhook
+	Channel string `toml:"channel" json:"channel"` // channel of redis publish
+	Timeout uint   `toml:"timeout" json:"timeout"` // timeout of webhook in seconds, default 10
+}
+
+type AlertConfig struct {
+	Enable   bool              `toml:"enable" json:"enable"`
+	Interval string            `toml:"interval" json:"interval"` // evaluate interval, such as "30s"
+	Keep     int               `toml:"keep" json:"keep"`         // events of history kept in memory
+	Rules    []AlertRule       `toml:"rules" json:"rules"`
+	Sinks    []AlertSinkConfig `toml:"sinks" json:"sinks"`
 }
 
 type LogConfig struct {
@@ -39,6 +108,7 @@ type LogConfig struct {
 	Filename      string `toml:"filename" json:"filename"`
 	Rotate_files  uint   `toml:"rotate_files" json:"rotate_files"`
 	Rotate_mbytes uint   `toml:"rotate_mbytes" json:"rotate_mbytes"`
+	AuditFilename string `toml:"audit_filename" json:"audit_filename"`
 }
 
 type NacosConfig struct {
@@ -60,14 +130,19 @@ type MyConfig struct {
 	Host      string `toml:"host" json:"host"`
 	Port      uint   `toml:"port" json:"port"`
 	SslEnable bool   `toml:"ssl_enable" json:"ssl_enable"`
+	BodyLimit uint   `toml:"body_limit" json:"body_limit"` // max request body in MBytes, default 4
 
-	MysqlConfig DBConfig    `toml:"mysql" json:"mysql"`
-	MinioConfig MinioConfig `toml:"minio" json:"minio"`
-	RedisConfig RedisConfig `toml:"redis" json:"redis"`
-	CkConfig    DBConfig    `toml:"clickhouse" json:"clickhouse"`
-	PgConfig    DBConfig    `toml:"postgresql" json:"postgresql"`
-	NacosConfig NacosConfig `toml:"nacos" json:"nacos"`
-	LogConfig   LogConfig   `toml:"log" json:"log"`
+	MysqlConfig   DBConfig      `toml:"mysql" json:"mysql"`
+	MinioConfig   MinioConfig   `toml:"minio" json:"minio"`
+	RedisConfig   RedisConfig   `toml:"redis" json:"redis"`
+	CkConfig      DBConfig      `toml:"clickhouse" json:"clickhouse"`
+	PgConfig      DBConfig      `toml:"postgresql" json:"postgresql"`
+	NacosConfig   NacosConfig   `toml:"nacos" json:"nacos"`
+	SchemaConfig  SchemaConfig  `toml:"schema" json:"schema"`
+	SamplerConfig SamplerConfig `toml:"sampler" json:"sampler"`
+	AlertConfig   AlertConfig   `toml:"alert" json:"alert"`
+	AuthConfig    AuthConfig    `toml:"auth" json:"auth"`
+	LogConfig     LogConfig     `toml:"log" json:"log"`
 }
 
 func (p *MyConfig) Dump() []byte {
@@ -2,9 +2,8 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net/url"
-	"os"
+	"regexp"
 	"strconv"
 	"time"
 
@@ -19,6 +18,9 @@ const (
 	MYSQL_MAX_TIMEOUT = 30 // mysql max timeout in seconds
 )
 
+// AUTO_INCREMENT=n of ddl is changed by insert, not a schema change
+var mysqlAutoIncrement = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
 type MysqlHandler struct {
 	DbHandler
 	cfg *mysql.Config // mysql config of dsn
@@ -41,6 +43,11 @@ func (p *MysqlHandler) AddRouter(r fiber.Router) error {
 	r.Get("/table/:table/stats", p.statsHandler)             // 表统计
 	r.Get("/table/:table/describe", p.describeHandler)       // 表描述
 	r.Get("/table/:table/ddl", p.ddlHandler)
+	r.Post("/table/:table/row", adminOnly, p.rowInsertHandler)   // 插入行
+	r.Put("/table/:table/row", adminOnly, p.rowUpdateHandler)    // 更新行
+	r.Patch("/table/:table/row", adminOnly, p.rowPatchHandler)   // 更新行的部分字段
+	r.Delete("/table/:table/row", adminOnly, p.rowDeleteHandler) // 删除行
+	r.Post("/table/:table/import", adminOnly, p.importHandler)   // 导入 xlsx|csv|ndjson
 	r.Get("/views", p.viewsHandler)
 	r.Get("/view/:table", p.tableHandler)
 	r.Get("/view/:table/columns", p.columnsHandler)
@@ -77,6 +84,10 @@ func (p *MysqlHandler) homeHandler(c fiber.Ctx) error {
 	c.WriteString(`<html><body><h1>Mysql Information</h1>
 	<a href="/mysql/tables?mime=json">tables</a><br>
 	<a href="/mysql/table/:table?mime=json">table/:table_name/[columns|indexes|constraints|keys|references|triggers|stats|describe|ddl]</a><br>
+	POST|PUT|PATCH|DELETE /mysql/table/:table/row 行数据写接口，需配置 writable = true（admin）<br>
+	POST /mysql/table/:table/import?mode=dryrun|commit 上传 xlsx|csv|ndjson 文件导入表（admin）<br>
+	<a href="/mysql/schema/history">schema/history</a><br>
+	<a href="/mysql/schema/diff">schema/diff?from=&to=</a><br>
 	<a href="/mysql/views?mime=json">views</a><br>
 	<a href="/mysql/view/:view?mime=json">view/:view_name/[columns|indexes|constraints|keys|references|triggers|stats|describe|ddl]</a><br>
 	<a href="/mysql/procedures">procedures</a><br>
@@ -85,6 +96,7 @@ func (p *MysqlHandler) homeHandler(c fiber.Ctx) error {
 	<a href="/mysql/event/:event">event/:event_name</a><br>
 	<a href="/mysql/triggers">triggers</a><br>
 	<a href="/mysql/trigger/:trigger">trigger/:trigger_name</a><br>
+	mime=excel|docx 导出文件，加 dest=minio://bucket/prefix/ 上传到 minio 并返回预签名下载链接（admin）<br>
 	</body></html>`)
 	return nil
 }
@@ -128,7 +140,7 @@ func (p *MysqlHandler) tablesViewsHandler(c fiber.Ctx, table_type string) error
 	case "json":
 		// return p.sqlHandlerByJson(c, sqltext)
 		// use local cache to reduce mysql load
-		if b, found := p.Mycache.Get("mysql:tables"); found {
+		if b, found := cacheGet(p.Mycache, "mysql:tables"); found {
 			c.Response().Header.Set("Content-Type", "application/json")
 			c.Write(b.([]byte))
 			return nil
@@ -169,15 +181,7 @@ func (p *MysqlHandler) tablesViewsHandler(c fiber.Ctx, table_type string) error
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	case "docx":
 		filename := p.cfg.DBName + "-tables.docx"
@@ -190,15 +194,7 @@ func (p *MysqlHandler) tablesViewsHandler(c fiber.Ctx, table_type string) error
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -244,15 +240,7 @@ func (p *MysqlHandler) columnsHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -317,15 +305,7 @@ func (p *MysqlHandler) indexesHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -380,15 +360,7 @@ func (p *MysqlHandler) tableHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -517,6 +489,140 @@ func (p *MysqlHandler) triggerHandler(c fiber.Ctx) error {
 	return p.sqlHandler2Json(c, sqltext)
 }
 
+// POST /mysql/table/:table/row
+func (p *MysqlHandler) rowInsertHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.insertRow(c, mysqlDialect, t)
+}
+
+// PUT /mysql/table/:table/row
+func (p *MysqlHandler) rowUpdateHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.updateRow(c, mysqlDialect, t, false)
+}
+
+// PATCH /mysql/table/:table/row
+func (p *MysqlHandler) rowPatchHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.updateRow(c, mysqlDialect, t, true)
+}
+
+// DELETE /mysql/table/:table/row
+func (p *MysqlHandler) rowDeleteHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.deleteRow(c, mysqlDialect, t)
+}
+
+// POST /mysql/table/:table/import?mode=dryrun|commit
+func (p *MysqlHandler) importHandler(c fiber.Ctx) error {
+	table, _ := url.QueryUnescape(c.Params("table"))
+	columns, err := p.getColumns(table)
+	if err != nil {
+		return err
+	}
+	types, err := p.queryMap(`select column_name, data_type
+		from INFORMATION_SCHEMA.COLUMNS
+		where table_schema = ? and table_name = ?`, p.cfg.DBName, table)
+	if err != nil {
+		return err
+	}
+
+	return p.importRows(c, mysqlDialect, table, columns, types)
+}
+
+// get columns and primary keys of table for row write api
+func (p *MysqlHandler) getRowTable(c fiber.Ctx) (*rowTable, error) {
+	if err := p.checkWritable(); err != nil {
+		return nil, err
+	}
+	table, _ := url.QueryUnescape(c.Params("table"))
+
+	columns, err := p.getColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	pkeys, err := p.queryColumn(`select column_name
+		from INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		where table_schema = ? and table_name = ? and constraint_name = 'PRIMARY'
+		order by ordinal_position`, p.cfg.DBName, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newRowTable(table, columns, pkeys)
+}
+
+// capture schema of database for SchemaTracker
+func (p *MysqlHandler) schemaSnapshot() (*SchemaSnapshot, error) {
+	if p.cfg == nil {
+		return nil, fmt.Errorf("%s %w", p.Dbconfig.Dbtype, errDsnInvalid)
+	}
+	tables, err := p.queryRows(`select table_name, table_type
+		from INFORMATION_SCHEMA.TABLES
+		where table_schema = ?
+		order by table_name`, p.cfg.DBName)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := p.queryRows(`select table_name, column_name, column_type, is_nullable, column_default
+		from INFORMATION_SCHEMA.COLUMNS
+		where table_schema = ?
+		order by table_name, ordinal_position`, p.cfg.DBName)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := p.queryRows(`select table_name, index_name,
+			concat(if(non_unique = 0, 'UNIQUE ', ''), index_type,
+				' (', group_concat(column_name order by seq_in_index), ')')
+		from INFORMATION_SCHEMA.STATISTICS
+		where table_schema = ?
+		group by table_name, index_name, non_unique, index_type`, p.cfg.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	ddls := make([][]string, 0, len(tables))
+	for _, table := range tables {
+		rows, err := p.queryRows("show create table " + mysqlDialect.quote(table[0]))
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 && len(rows[0]) > 1 {
+			ddls = append(ddls, []string{table[0], mysqlAutoIncrement.ReplaceAllString(rows[0][1], "")})
+		}
+	}
+
+	return buildSnapshot(p.Dbconfig.Dbtype, p.cfg.DBName, tables, columns, indexes, ddls), nil
+}
+
+// value of alert rule, metric is variable of SHOW GLOBAL STATUS such as threads_running
+func (p *MysqlHandler) alertValue(rule *AlertRule) (float64, error) {
+	if rule.Query != "" {
+		return p.DbHandler.alertValue(rule)
+	}
+	// '=' instead of LIKE, '_' of name is wildcard of LIKE. name is case insensitive
+	m, err := p.queryMap("SHOW GLOBAL STATUS WHERE Variable_name = ?", rule.Metric)
+	if err != nil {
+		return 0, err
+	}
+	for _, value := range m {
+		return strconv.ParseFloat(value, 64)
+	}
+	return 0, fmt.Errorf("unknown mysql status '%s'", rule.Metric)
+}
+
 // get columns of table to string with ',' split. sort by ordinal_position
 func (p *MysqlHandler) getColumns(table string) ([]string, error) {
 	if p.db == nil {
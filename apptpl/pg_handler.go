@@ -2,10 +2,9 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net/url"
-	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v3"
 	_ "github.com/lib/pq"
@@ -33,6 +32,11 @@ func (p *PgHandler) AddRouter(r fiber.Router) error {
 	r.Get("/table/:table", p.tableHandler)
 	r.Get("/table/:table/columns", p.columnsHandler)
 	r.Get("/table/:table/indexes", p.indexesHandler)
+	r.Post("/table/:table/row", adminOnly, p.rowInsertHandler)   // 插入行
+	r.Put("/table/:table/row", adminOnly, p.rowUpdateHandler)    // 更新行
+	r.Patch("/table/:table/row", adminOnly, p.rowPatchHandler)   // 更新行的部分字段
+	r.Delete("/table/:table/row", adminOnly, p.rowDeleteHandler) // 删除行
+	r.Post("/table/:table/import", adminOnly, p.importHandler)   // 导入 xlsx|csv|ndjson
 	r.Get("/views", p.viewsHandler)
 	r.Get("/view/:table", p.viewHandler)
 	r.Get("/procedures", p.proceduresHandler)
@@ -56,6 +60,10 @@ func (p *PgHandler) homeHandler(c fiber.Ctx) error {
 	c.WriteString(`<html><body><h1>Postgresql Information</h1>
 	<a href="/postgresql/tables?mime=json">tables</a><br>
 	<a href="/postgresql/table/:table?mime=json">table/:table_name/[columns|indexes|constraints|keys|references|triggers|stats|describe|ddl]</a><br>
+	POST|PUT|PATCH|DELETE /postgresql/table/:table/row 行数据写接口，需配置 writable = true（admin）<br>
+	POST /postgresql/table/:table/import?mode=dryrun|commit 上传 xlsx|csv|ndjson 文件导入表（admin）<br>
+	<a href="/postgresql/schema/history">schema/history</a><br>
+	<a href="/postgresql/schema/diff">schema/diff?from=&to=</a><br>
 	<a href="/postgresql/views?mime=json">views</a><br>
 	<a href="/postgresql/view/:view?mime=json">view/:view_name/[columns|indexes|constraints|keys|references|triggers|stats|describe|ddl]</a><br>
 	<a href="/postgresql/procedures">procedures</a><br>
@@ -64,6 +72,7 @@ func (p *PgHandler) homeHandler(c fiber.Ctx) error {
 	<a href="/postgresql/event/:event">event/:event_name</a><br>
 	<a href="/postgresql/triggers">triggers</a><br>
 	<a href="/postgresql/trigger/:trigger">trigger/:trigger_name</a><br>
+	mime=excel 导出文件，加 dest=minio://bucket/prefix/ 上传到 minio 并返回预签名下载链接（admin）<br>
 	</body></html>`)
 	return nil
 }
@@ -105,15 +114,7 @@ order by tab.schemaname, tab.tablename`
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -158,15 +159,7 @@ func (p *PgHandler) columnsHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -219,15 +212,7 @@ where
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -264,15 +249,7 @@ func (p *PgHandler) tableHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -320,15 +297,7 @@ func (p *PgHandler) viewsHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -365,15 +334,7 @@ func (p *PgHandler) viewHandler(c fiber.Ctx) error {
 			return err
 		}
 
-		c.Attachment(filename)
-		fp, err := os.Open("log/" + filename)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(c, fp)
-		fp.Close()
-		os.Remove("log/" + filename)
-		return err
+		return sendExport(c, p.Minio, filename)
 
 	default:
 		c.Status(400)
@@ -403,3 +364,124 @@ func (p *PgHandler) procedureHandler(c fiber.Ctx) error {
 	sqltext := fmt.Sprintf(`select * from pg_proc where proname = '%s'`, procedure)
 	return p.sqlHandler2Json(c, sqltext)
 }
+
+// POST /postgresql/table/:table/row
+func (p *PgHandler) rowInsertHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.insertRow(c, pgDialect, t)
+}
+
+// PUT /postgresql/table/:table/row
+func (p *PgHandler) rowUpdateHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.updateRow(c, pgDialect, t, false)
+}
+
+// PATCH /postgresql/table/:table/row
+func (p *PgHandler) rowPatchHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.updateRow(c, pgDialect, t, true)
+}
+
+// DELETE /postgresql/table/:table/row
+func (p *PgHandler) rowDeleteHandler(c fiber.Ctx) error {
+	t, err := p.getRowTable(c)
+	if err != nil {
+		return err
+	}
+	return p.deleteRow(c, pgDialect, t)
+}
+
+// POST /postgresql/table/:table/import?mode=dryrun|commit
+func (p *PgHandler) importHandler(c fiber.Ctx) error {
+	table, _ := url.QueryUnescape(c.Params("table"))
+	columns, err := p.getColumns(table)
+	if err != nil {
+		return err
+	}
+	types, err := p.queryMap(`select column_name, data_type
+		from information_schema.columns
+		where table_schema = current_schema() and table_name = $1`, table)
+	if err != nil {
+		return err
+	}
+
+	return p.importRows(c, pgDialect, table, columns, types)
+}
+
+// get columns and primary keys of table for row write api
+func (p *PgHandler) getRowTable(c fiber.Ctx) (*rowTable, error) {
+	if err := p.checkWritable(); err != nil {
+		return nil, err
+	}
+	table, _ := url.QueryUnescape(c.Params("table"))
+
+	columns, err := p.getColumns(table)
+	if err != nil {
+		return nil, err
+	}
+	pkeys, err := p.queryColumn(`select a.attname
+		from pg_index i
+			join pg_class cla on cla.oid = i.indrelid
+			join pg_attribute a on a.attrelid = i.indrelid and a.attnum = any(i.indkey)
+		where i.indisprimary
+			and cla.relname = $1
+			and cla.relnamespace = current_schema()::regnamespace`, table)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newRowTable(table, columns, pkeys)
+}
+
+// capture schema of current schema for SchemaTracker, ddl is definition of view only
+func (p *PgHandler) schemaSnapshot() (*SchemaSnapshot, error) {
+	if p.u == nil {
+		return nil, fmt.Errorf("%s %w", p.Dbconfig.Dbtype, errDsnInvalid)
+	}
+	tables, err := p.queryRows(`select table_name, table_type
+		from information_schema.tables
+		where table_schema = current_schema()
+		order by table_name`)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := p.queryRows(`select table_name, column_name, data_type, is_nullable, column_default
+		from information_schema.columns
+		where table_schema = current_schema()
+		order by table_name, ordinal_position`)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := p.queryRows(`select tablename, indexname, indexdef
+		from pg_indexes
+		where schemaname = current_schema()`)
+	if err != nil {
+		return nil, err
+	}
+	ddls, err := p.queryRows(`select viewname, definition
+		from pg_views
+		where schemaname = current_schema()`)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildSnapshot(p.Dbconfig.Dbtype, strings.TrimPrefix(p.u.Path, "/"), tables, columns, indexes, ddls), nil
+}
+
+// get columns of table in current schema, sort by ordinal_position
+func (p *PgHandler) getColumns(table string) ([]string, error) {
+	return p.queryColumn(`select column_name
+		from information_schema.columns
+		where table_schema = current_schema() and table_name = $1
+		order by ordinal_position`, table)
+}
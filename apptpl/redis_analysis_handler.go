@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	REDIS_SAMPLE_KEYS     = 100000  // default max keys sampled by SCAN of tree and bigkeys
+	REDIS_MAX_SAMPLE_KEYS = 1000000 // max of query limit
+	REDIS_MAX_TOP         = 1000    // max of query top of bigkeys
+	REDIS_MAX_DEPTH       = 32      // max of query depth of tree
+	REDIS_SCAN_BATCH      = 1000    // COUNT of SCAN and keys per pipeline
+)
+
+// int query of 1 to max, such as limit of keys sampled
+func queryBetween(c fiber.Ctx, key string, def, max int) (int, error) {
+	v := fiber.Query(c, key, def)
+	if v <= 0 || v > max {
+		return 0, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s should be 1 to %d", key, max))
+	}
+	return v, nil
+}
+
+// node of key namespace tree, such as 'user' and 'user:1' of key 'user:1:name'
+type redisTreeNode struct {
+	Name     string           `json:"name"`
+	Prefix   string           `json:"prefix"`
+	Keys     int64            `json:"keys"`   // keys under this prefix, include children
+	Memory   int64            `json:"memory"` // bytes of keys under this prefix
+	Children []*redisTreeNode `json:"children,omitempty"`
+	children map[string]*redisTreeNode
+}
+
+func (n *redisTreeNode) child(name, prefix string) *redisTreeNode {
+	if n.children == nil {
+		n.children = make(map[string]*redisTreeNode)
+	}
+	if child, ok := n.children[name]; ok {
+		return child
+	}
+	child := &redisTreeNode{Name: name, Prefix: prefix}
+	n.children[name] = child
+	n.Children = append(n.Children, child)
+	return child
+}
+
+// sort children by memory desc
+func (n *redisTreeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Memory != n.Children[j].Memory {
+			return n.Children[i].Memory > n.Children[j].Memory
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
+
+// SCAN keys of all masters by batch and get metadata, until limit keys or the end.
+// return number of keys scanned, and scanned all keys or not.
+func scanEach(ctx context.Context, cli redis.UniversalClient, match string, limit int,
+	fn func(metas []redisKey)) (int, bool, error) {
+
+	scanned := 0
+	complete, err := scanAll(ctx, cli, match, func(node redis.Cmdable, keys []string) (bool, error) {
+		if scanned+len(keys) > limit {
+			keys = keys[:limit-scanned]
+		}
+		fn(keysMeta(ctx, node, keys))
+		scanned += len(keys)
+		return scanned >= limit, nil
+	})
+	return scanned, complete, err
+}
+
+// GET /redis/db/:db/tree?delimiter=:&match=*&depth=5&limit=100000
+// group keys by delimiter into namespace tree with number of keys and memory per prefix.
+// when keys is more than limit, the tree is built from first limit keys of SCAN.
+func (p *RedisHandler) treeHandler(c fiber.Ctx) error {
+	delimiter := c.Query("delimiter", p.Redisconfig.Delimiter)
+	if delimiter == "" {
+		delimiter = ":"
+	}
+	match := c.Query("match", "*")
+	depth, err := queryBetween(c, "depth", 5, REDIS_MAX_DEPTH)
+	if err != nil {
+		return err
+	}
+	limit, err := queryBetween(c, "limit", REDIS_SAMPLE_KEYS, REDIS_MAX_SAMPLE_KEYS)
+	if err != nil {
+		return err
+	}
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*p.timeout())
+	defer cancel()
+
+	root := &redisTreeNode{}
+	scanned, complete, err := scanEach(ctx, cli, match, limit, func(metas []redisKey) {
+		for _, meta := range metas {
+			memory := max(meta.Memory, 0)
+			node := root
+			node.Keys++
+			node.Memory += memory
+
+			// the last part is key name, not a namespace
+			parts := strings.Split(meta.Key, delimiter)
+			for i := 0; i < len(parts)-1 && i < depth; i++ {
+				node = node.child(parts[i], strings.Join(parts[:i+1], delimiter)+delimiter)
+				node.Keys++
+				node.Memory += memory
+			}
+		}
+	})
+	if err != nil {
+		log.Errorf("redis scan tree of '%s' failed: %v", match, err)
+		return err
+	}
+	root.sort()
+
+	return c.JSON(fiber.Map{
+		"delimiter": delimiter,
+		"scanned":   scanned,
+		"complete":  complete,
+		"keys":      root.Keys,
+		"memory":    root.Memory,
+		"children":  root.Children,
+	})
+}
+
+// GET /redis/db/:db/bigkeys?match=*&top=20&limit=100000
+// sample keys by SCAN, find the largest keys by MEMORY USAGE, and by number of elements per type.
+func (p *RedisHandler) bigkeysHandler(c fiber.Ctx) error {
+	match := c.Query("match", "*")
+	top, err := queryBetween(c, "top", 20, REDIS_MAX_TOP)
+	if err != nil {
+		return err
+	}
+	limit, err := queryBetween(c, "limit", REDIS_SAMPLE_KEYS, REDIS_MAX_SAMPLE_KEYS)
+	if err != nil {
+		return err
+	}
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*p.timeout())
+	defer cancel()
+
+	byMemory := make([]redisKey, 0, top+REDIS_SCAN_BATCH)
+	byLength := make(map[string][]redisKey)
+	types := make(map[string]fiber.Map) // type -> count and memory
+	scanned, complete, err := scanEach(ctx, cli, match, limit, func(metas []redisKey) {
+		for _, meta := range metas {
+			stat, ok := types[meta.Type]
+			if !ok {
+				stat = fiber.Map{"keys": int64(0), "memory": int64(0)}
+				types[meta.Type] = stat
+			}
+			stat["keys"] = stat["keys"].(int64) + 1
+			stat["memory"] = stat["memory"].(int64) + max(meta.Memory, 0)
+
+			if meta.Length >= 0 {
+				byLength[meta.Type] = topKeys(append(byLength[meta.Type], meta), top,
+					func(a, b redisKey) bool { return a.Length > b.Length })
+			}
+		}
+		byMemory = topKeys(append(byMemory, metas...), top,
+			func(a, b redisKey) bool { return a.Memory > b.Memory })
+	})
+	if err != nil {
+		log.Errorf("redis scan bigkeys of '%s' failed: %v", match, err)
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"scanned":   scanned,
+		"complete":  complete,
+		"types":     types,
+		"by_memory": byMemory,
+		"by_length": byLength,
+	})
+}
+
+// sort keys by less and keep top n
+func topKeys(keys []redisKey, n int, less func(a, b redisKey) bool) []redisKey {
+	sort.SliceStable(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// GET /redis/cluster/nodes, parsed from CLUSTER NODES
+func (p *RedisHandler) clusterNodesHandler(c fiber.Ctx) error {
+	cluster, err := p.clusterClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	text, err := cluster.ClusterNodes(ctx).Result()
+	if err != nil {
+		log.Errorf("redis cluster nodes failed: %v", err)
+		return err
+	}
+
+	// <id> <ip:port@cport[,hostname]> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+	nodes := make([]fiber.Map, 0)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		addr, hostname, _ := strings.Cut(fields[1], ",")
+		addr, _, _ = strings.Cut(addr, "@")
+		master := fields[3]
+		if master == "-" {
+			master = ""
+		}
+		pingSent, _ := strconv.ParseInt(fields[4], 10, 64)
+		pongRecv, _ := strconv.ParseInt(fields[5], 10, 64)
+		epoch, _ := strconv.ParseInt(fields[6], 10, 64)
+		nodes = append(nodes, fiber.Map{
+			"id":           fields[0],
+			"addr":         addr,
+			"hostname":     hostname,
+			"flags":        strings.Split(fields[2], ","),
+			"master":       master,
+			"ping_sent":    pingSent,
+			"pong_recv":    pongRecv,
+			"config_epoch": epoch,
+			"link_state":   fields[7],
+			"slots":        fields[8:],
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i]["addr"].(string) < nodes[j]["addr"].(string) })
+
+	return c.JSON(nodes)
+}
+
+// GET /redis/cluster/slots, slot ranges with master and replicas from CLUSTER SLOTS
+func (p *RedisHandler) clusterSlotsHandler(c fiber.Ctx) error {
+	cluster, err := p.clusterClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	slots, err := cluster.ClusterSlots(ctx).Result()
+	if err != nil {
+		log.Errorf("redis cluster slots failed: %v", err)
+		return err
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start < slots[j].Start })
+
+	list := make([]fiber.Map, len(slots))
+	for i, slot := range slots {
+		m := fiber.Map{"start": slot.Start, "end": slot.End, "count": slot.End - slot.Start + 1}
+		replicas := make([]fiber.Map, 0)
+		for j, node := range slot.Nodes {
+			if j == 0 { // the first node is master
+				m["master"] = fiber.Map{"id": node.ID, "addr": node.Addr}
+			} else {
+				replicas = append(replicas, fiber.Map{"id": node.ID, "addr": node.Addr})
+			}
+		}
+		m["replicas"] = replicas
+		list[i] = m
+	}
+
+	return c.JSON(list)
+}
+
+// GET /redis/sentinel, master, replicas and sentinels of RedisConfig.MasterName
+func (p *RedisHandler) sentinelHandler(c fiber.Ctx) error {
+	if p.Redisconfig.Mode != "sentinel" {
+		return fiber.NewError(fiber.StatusBadRequest, "redis is not in sentinel mode")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	// ask sentinels one by one until one is reachable
+	var lastErr error
+	for _, addr := range p.redisAddrs() {
+		sentinel := redis.NewSentinelClient(&redis.Options{
+			Addr:     addr,
+			Password: p.Redisconfig.SentinelPassword,
+		})
+		master, err := sentinel.Master(ctx, p.Redisconfig.MasterName).Result()
+		if err != nil {
+			sentinel.Close()
+			log.Warnf("redis sentinel %s master '%s' failed: %v", addr, p.Redisconfig.MasterName, err)
+			lastErr = err
+			continue
+		}
+		replicas, _ := sentinel.Replicas(ctx, p.Redisconfig.MasterName).Result()
+		sentinels, _ := sentinel.Sentinels(ctx, p.Redisconfig.MasterName).Result()
+		sentinel.Close()
+
+		return c.JSON(fiber.Map{
+			"sentinel":  addr,
+			"master":    master,
+			"replicas":  replicas,
+			"sentinels": sentinels,
+		})
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no sentinel addrs")
+	}
+	return fiber.NewError(fiber.StatusServiceUnavailable, lastErr.Error())
+}
+
+func (p *RedisHandler) clusterClient() (*redis.ClusterClient, error) {
+	if p.Redisconfig.Mode != "cluster" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "redis is not in cluster mode")
+	}
+	cli, err := p.defaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return cli.(*redis.ClusterClient), nil
+}
+
+// seed nodes of cluster or sentinels, default RedisConfig.Addr
+func (p *RedisHandler) redisAddrs() []string {
+	if len(p.Redisconfig.Addrs) > 0 {
+		return p.Redisconfig.Addrs
+	}
+	return []string{p.Redisconfig.Addr}
+}
+
+// clients of every master sort by addr, SCAN of cluster should be sent to each master.
+// return cli itself when it is not a cluster client.
+func masterClients(ctx context.Context, cli redis.UniversalClient) ([]redis.Cmdable, error) {
+	cluster, ok := cli.(*redis.ClusterClient)
+	if !ok {
+		return []redis.Cmdable{cli}, nil
+	}
+
+	masters := make([]*redis.Client, 0)
+	var mutex sync.Mutex
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		masters = append(masters, master)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(masters, func(i, j int) bool { return masters[i].Options().Addr < masters[j].Options().Addr })
+
+	list := make([]redis.Cmdable, len(masters))
+	for i, master := range masters {
+		list[i] = master
+	}
+	return list, nil
+}
+
+// SCAN one page of keys across masters. cursor is the cursor of SCAN for standalone,
+// and '<master index>-<cursor>' for cluster. return next cursor, '0' means the end.
+func scanKeys(ctx context.Context, cli redis.UniversalClient, cursor string,
+	match, keytype string, count int) ([]string, string, error) {
+
+	masters, err := masterClients(ctx, cli)
+	if err != nil {
+		return nil, "", err
+	}
+
+	node := 0
+	var pos uint64
+	if len(masters) > 1 && cursor != "0" {
+		n, c, _ := strings.Cut(cursor, "-")
+		node, err = strconv.Atoi(n)
+		if err == nil {
+			pos, err = strconv.ParseUint(c, 10, 64)
+		}
+		if err != nil || node < 0 || node >= len(masters) {
+			return nil, "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid cursor '%s'", cursor))
+		}
+	} else if pos, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+		return nil, "", fiber.NewError(fiber.StatusBadRequest, "invalid cursor: "+err.Error())
+	}
+
+	keys := make([]string, 0, count)
+	for node < len(masters) && len(keys) < count {
+		page, next, err := scanPage(ctx, masters[node], pos, match, keytype, count-len(keys))
+		if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, page...)
+		pos = next
+		if pos == 0 {
+			node++
+		}
+	}
+
+	switch {
+	case node >= len(masters):
+		return keys, "0", nil
+	case len(masters) == 1:
+		return keys, strconv.FormatUint(pos, 10), nil
+	default:
+		return keys, fmt.Sprintf("%d-%d", node, pos), nil
+	}
+}
+
+// SCAN all keys of every master by batch, fn is called with the master and keys of batch,
+// stop when fn return true. return scanned all keys or not.
+func scanAll(ctx context.Context, cli redis.UniversalClient, match string,
+	fn func(node redis.Cmdable, keys []string) (bool, error)) (bool, error) {
+
+	masters, err := masterClients(ctx, cli)
+	if err != nil {
+		return false, err
+	}
+
+	for i, node := range masters {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, match, REDIS_SCAN_BATCH).Result()
+			if err != nil {
+				return false, err
+			}
+			cursor = next
+			if len(keys) > 0 {
+				stop, err := fn(node, keys)
+				if err != nil {
+					return false, err
+				}
+				if stop {
+					return cursor == 0 && i == len(masters)-1, nil
+				}
+			}
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+	return true, nil
+}
@@ -5,15 +5,38 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	REDIS_PAGE_SIZE     = 100         // default keys per page of SCAN
+	REDIS_MAX_PAGE_SIZE = 5000        // max keys per page of SCAN
+	REDIS_SCAN_ROUNDS   = 100         // max SCAN calls to fill a page
+	REDIS_MAX_STRING    = 1024 * 1024 // max bytes of string value in one response
+)
+
+// key with metadata in keys listing
+type redisKey struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Ttl    int64  `json:"ttl"`    // in milliseconds, -1 is no expire, -2 is not existed
+	Memory int64  `json:"memory"` // bytes of MEMORY USAGE, -1 is unknown
+	Length int64  `json:"length"` // strlen, or number of elements, -1 is unknown
+}
+
 type RedisHandler struct {
 	Redisconfig *RedisConfig
-	cli         *redis.Client
+	Jobs        *JobManager                   // background jobs such as bulk delete
+	cli         redis.UniversalClient         // client of default db RedisConfig.Db
+	clis        map[int]redis.UniversalClient // clients of db index in url /db/:db
+	mutex       sync.Mutex
 }
 
 // r := app.Group("/redis")
@@ -23,9 +46,32 @@ func (p *RedisHandler) AddRouter(r fiber.Router) error {
 	r.Get("", p.homeHandler)
 	r.Get("/", p.homeHandler)
 	r.Get("/dbs", p.dbsHandler)
+	r.Get("/cluster/nodes", p.clusterNodesHandler)
+	r.Get("/cluster/slots", p.clusterSlotsHandler)
+	r.Get("/sentinel", p.sentinelHandler)
+	r.Get("/info", p.infoHandler)
+	r.Get("/slowlog", p.slowlogHandler)
+	r.Get("/clients", adminOnly, p.clientsHandler)
+	r.Delete("/clients/:id", adminOnly, p.clientKillHandler)
+	r.Get("/latency", p.latencyHandler)
+	r.Get("/config", adminOnly, p.configHandler)
+	r.Get("/subscribe", p.subscribeHandler)
 	r.Get("/db/:db/keys", p.keysHandler)
 	r.Get("/db/:db/keys/:prefix", p.keysHandler)
 	r.Get("/db/:db/key/:key", p.keyHandler)
+	r.Get("/db/:db/tree", p.treeHandler)
+	r.Get("/db/:db/bigkeys", p.bigkeysHandler)
+	r.Get("/db/:db/events", p.eventsHandler)
+
+	// write operations, admin role only
+	r.Put("/db/:db/key/:key", adminOnly, p.setHandler)
+	r.Delete("/db/:db/key/:key", adminOnly, p.deleteHandler)
+	r.Post("/db/:db/key/:key/expire", adminOnly, p.expireHandler)
+	r.Post("/db/:db/key/:key/persist", adminOnly, p.persistHandler)
+	r.Post("/db/:db/key/:key/rename", adminOnly, p.renameHandler)
+	r.Delete("/db/:db/keys", adminOnly, p.deleteKeysHandler)
+	r.Get("/db/:db/export", adminOnly, p.exportHandler)
+	r.Post("/db/:db/import", adminOnly, p.importHandler)
 	// r.Get("/table/:table/indexs", p.indexsHandler)
 	// r.Get("/table/:table", p.tableHandler)
 
@@ -37,146 +83,591 @@ func (p *RedisHandler) homeHandler(c fiber.Ctx) error {
 	c.Response().Header.Set("Content-Type", "text/html")
 	c.WriteString(`<html><body><h1>Redis Information</h1>
 	<a href="/redis/dbs?mime=json">dbs</a><br>
-	<a href="/redis/db/:db/keys">db/:db/keys</a><br>
-	<a href="/redis/db/:db/keys/:prefix">db/:db/keys/:prefix</a><br>
-	<a href="/redis/db/:db/key/:key">/db/:db/key/:key</a><br>
+	<a href="/redis/cluster/nodes">cluster/nodes</a><br>
+	<a href="/redis/cluster/slots">cluster/slots</a><br>
+	<a href="/redis/sentinel">sentinel</a><br>
+	<a href="/redis/info">info?section=&node=</a><br>
+	<a href="/redis/slowlog">slowlog?count=128&node=</a><br>
+	<a href="/redis/clients">clients?node=</a> (admin)<br>
+	<a href="/redis/latency">latency?event=&node=</a><br>
+	<a href="/redis/config">config?pattern=*&node=</a> (admin)<br>
+	<a href="/redis/subscribe">subscribe?channel=&pattern=</a> (Server-Sent Events)<br>
+	<a href="/redis/db/:db/keys">db/:db/keys?cursor=0&count=100&type=</a><br>
+	<a href="/redis/db/:db/keys/:prefix">db/:db/keys/:prefix?cursor=0&count=100&type=</a><br>
+	<a href="/redis/db/:db/key/:key">/db/:db/key/:key?start=0&count=100&cursor=0&format=bitmap</a><br>
+	<a href="/redis/db/:db/tree">/db/:db/tree?delimiter=:&match=*&depth=5&limit=100000</a><br>
+	<a href="/redis/db/:db/bigkeys">/db/:db/bigkeys?match=*&top=20&limit=100000</a><br>
+	<a href="/redis/db/:db/events">/db/:db/events?pattern=*&type=keyspace|keyevent</a> (Server-Sent Events)<br>
+	<h2>Admin only</h2>
+	PUT /db/:db/key/:key {"type": "string", "value": "v", "ttl": 60000}<br>
+	DELETE /db/:db/key/:key<br>
+	DELETE /clients/:id?node= (CLIENT KILL)<br>
+	POST /db/:db/key/:key/expire?ttl=60<br>
+	POST /db/:db/key/:key/persist<br>
+	POST /db/:db/key/:key/rename?to=&nx=true<br>
+	DELETE /db/:db/keys?match=user:* (background job, see <a href="/jobs">/jobs</a>)<br>
+	<a href="/redis/db/:db/export">/db/:db/export?match=*&limit=1000</a><br>
+	POST /db/:db/import?replace=false<br>
 	</body></html>`)
 	return nil
 }
 
-// GET /dbs?mime=excel|json
+// GET /redis/dbs
+// from INFO keyspace such as 'db0:keys=1,expires=0,avg_ttl=0', empty db is not listed
 func (p *RedisHandler) dbsHandler(c fiber.Ctx) error {
-	return fiber.NewError(500, "not ready for /dbs")
+	cli, err := p.defaultClient()
+	if err != nil {
+		return err
+	}
+
+	// cluster has only db 0, DBSIZE of cluster client is sum of all masters
+	if cluster, ok := cli.(*redis.ClusterClient); ok {
+		keys, err := cluster.DBSize(context.Background()).Result()
+		if err != nil {
+			log.Errorf("redis cluster dbsize failed: %v", err)
+			return err
+		}
+		return c.JSON(fiber.Map{
+			"databases": 1,
+			"dbs":       []fiber.Map{{"db": 0, "keys": keys}},
+		})
+	}
+
+	info, err := cli.Info(context.Background(), "keyspace").Result()
+	if err != nil {
+		log.Errorf("redis info keyspace failed: %v", err)
+		return err
+	}
+
+	dbs := make([]fiber.Map, 0)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		name, fields, ok := strings.Cut(line, ":")
+		if !ok || !strings.HasPrefix(name, "db") {
+			continue
+		}
+		db, err := strconv.Atoi(name[2:])
+		if err != nil {
+			continue
+		}
+
+		m := fiber.Map{"db": db}
+		for _, field := range strings.Split(fields, ",") {
+			k, v, _ := strings.Cut(field, "=")
+			n, _ := strconv.ParseInt(v, 10, 64)
+			m[k] = n // keys, expires, avg_ttl in milliseconds, subexpiry of redis 7.4
+		}
+		dbs = append(dbs, m)
+	}
+
+	// number of databases, maybe CONFIG is disabled
+	databases := 0
+	if cfg, err := cli.ConfigGet(context.Background(), "databases").Result(); err == nil {
+		databases, _ = strconv.Atoi(cfg["databases"])
+	}
+
+	return c.JSON(fiber.Map{
+		"databases": databases,
+		"dbs":       dbs,
+	})
 }
 
-// GET /db/:db/keys?mime=excel|json
+// GET /redis/db/:db/keys/:prefix?cursor=0&count=100&type=string|list|hash|set|zset|stream
+// use SCAN instead of KEYS which blocks redis, return next cursor, 0 means the end.
+// cursor of cluster is '<master index>-<cursor>', SCAN masters one by one.
 func (p *RedisHandler) keysHandler(c fiber.Ctx) error {
 	prefix, _ := url.QueryUnescape(c.Params("prefix"))
+	if prefix == "" {
+		prefix = c.Query("match")
+	}
 	if prefix == "" {
 		prefix = "*"
 	} else if prefix[len(prefix)-1] != '*' {
 		prefix = prefix + "*"
 	}
-	log.Tracef("redis get key with prefix: %s", prefix)
+	cursor := c.Query("cursor", "0")
+	count := fiber.Query(c, "count", REDIS_PAGE_SIZE)
+	if count <= 0 || count > REDIS_MAX_PAGE_SIZE {
+		count = REDIS_PAGE_SIZE
+	}
+	keytype := c.Query("type")
+	log.Tracef("redis scan key with prefix: %s, cursor: %s, count: %d, type: %s", prefix, cursor, count, keytype)
 
-	if p.cli == nil {
-		err := p.openRedis()
-		if err != nil {
-			return err
-		}
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
 	}
 
-	keys, err := p.cli.Keys(context.Background(), prefix).Result()
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	keys, cursor, err := scanKeys(ctx, cli, cursor, prefix, keytype, count)
 	if err != nil {
-		log.Errorf("redis get keys prefix='%s' failed: %v", prefix, err)
+		log.Errorf("redis scan keys prefix='%s' failed: %v", prefix, err)
 		return err
 	}
 	sort.Strings(keys)
 
 	return c.JSON(fiber.Map{
-		"keys": keys,
+		"cursor": cursor, // string, uint64 maybe overflow in javascript
+		"keys":   keysMeta(ctx, cli, keys),
 	})
-
-	// return nil
 }
 
-// GET /db/:db/key/:key?mime=excel|json
+// GET /redis/db/:db/key/:key?start=0&count=100&cursor=0&format=bitmap
+// large value is read by window instead of whole: LRANGE, ZRANGE and XRANGE from start
+// with count, HSCAN and SSCAN from cursor, GETRANGE of string with max REDIS_MAX_STRING bytes.
+// start of stream is entry id, default '-'.
 func (p *RedisHandler) keyHandler(c fiber.Ctx) error {
 	key, _ := url.QueryUnescape(c.Params("key"))
-	if p.cli == nil {
-		err := p.openRedis()
-		if err != nil {
-			return err
-		}
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
 	}
+	count := fiber.Query(c, "count", REDIS_PAGE_SIZE)
+	if count <= 0 || count > REDIS_MAX_PAGE_SIZE {
+		count = REDIS_PAGE_SIZE
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
 
 	// 获取key的数据类型，例如string、list、hash等
-	datatype, err := p.cli.Type(context.Background(), key).Result()
+	datatype, err := cli.Type(ctx, key).Result()
 	if err != nil {
 		log.Errorf("redis get key '%s' data type failed: %v", key, err)
 		return err
 	}
 	log.Tracef("key datatype: %s", datatype)
+	if datatype == "none" {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("key '%s' not found", key))
+	}
+
+	m := fiber.Map{"key": key, "type": datatype}
+	if ttl, err := cli.PTTL(ctx, key).Result(); err == nil {
+		m["ttl"] = ttlMillis(ttl)
+	}
 
 	// 根据数据类型获取key的值
 	switch datatype {
 	case "string":
-		val, err := p.cli.Get(context.Background(), key).Result()
-		if err != nil {
-			log.Errorf("redis get key '%s' failed: %v", key, err)
-			return err
+		err = readString(ctx, cli, key, fiber.Query[int64](c, "start", 0), c.Query("format"), m)
+
+	case "list":
+		start := fiber.Query[int64](c, "start", 0)
+		m["length"], err = cli.LLen(ctx, key).Result()
+		if err == nil {
+			m["start"] = start
+			m["value"], err = cli.LRange(ctx, key, start, start+int64(count)-1).Result()
 		}
-		// log.Tracef("string key '%s' -> %#v\n", key, val)
 
-		return c.JSON(val)
+	case "hash":
+		var val []string
+		var cursor uint64
+		m["length"], err = cli.HLen(ctx, key).Result()
+		if err == nil {
+			val, cursor, err = cli.HScan(ctx, key, fiber.Query[uint64](c, "cursor", 0), "", int64(count)).Result()
+		}
+		if err == nil {
+			fields := make(map[string]string, len(val)/2)
+			for i := 0; i+1 < len(val); i += 2 {
+				fields[val[i]] = val[i+1]
+			}
+			m["value"] = fields
+			m["cursor"] = strconv.FormatUint(cursor, 10)
+		}
 
-	case "list":
-		val, err := p.cli.LRange(context.Background(), key, 0, -1).Result()
-		if err != nil {
-			log.Errorf("redis get key '%s' failed: %v", key, err)
-			return err
+	case "set":
+		var cursor uint64
+		m["length"], err = cli.SCard(ctx, key).Result()
+		if err == nil {
+			m["value"], cursor, err = cli.SScan(ctx, key, fiber.Query[uint64](c, "cursor", 0), "", int64(count)).Result()
+			m["cursor"] = strconv.FormatUint(cursor, 10)
 		}
-		// log.Tracef("hash key '%s' -> %#v\n", key, val)
 
-		return c.JSON(val)
+	case "zset":
+		var val []redis.Z
+		start := fiber.Query[int64](c, "start", 0)
+		m["length"], err = cli.ZCard(ctx, key).Result()
+		if err == nil {
+			val, err = cli.ZRangeWithScores(ctx, key, start, start+int64(count)-1).Result()
+		}
+		if err == nil {
+			members := make([]fiber.Map, len(val))
+			for i, z := range val {
+				members[i] = fiber.Map{"member": z.Member, "score": z.Score}
+			}
+			m["start"] = start
+			m["value"] = members
+		}
 
-	case "hash":
-		val, err := p.cli.HGetAll(context.Background(), key).Result()
-		if err != nil {
-			log.Errorf("redis get key '%s' failed: %v", key, err)
+	case "stream":
+		err = readStream(ctx, cli, key, c.Query("start", "-"), count, m)
+
+	case "ReJSON-RL": // RedisJSON module
+		m["value"], err = cli.JSONGet(ctx, key).Expanded()
+
+	case "TSDB-TYPE": // RedisTimeSeries module
+		m["info"], err = cli.TSInfo(ctx, key).Result()
+
+	case "MBbloom--": // RedisBloom module
+		m["info"], err = cli.BFInfo(ctx, key).Result()
+
+	default: // other module types, value is unknown
+		m["encoding"], _ = cli.ObjectEncoding(ctx, key).Result()
+		m["memory"], _ = cli.MemoryUsage(ctx, key).Result()
+	}
+	if err != nil {
+		log.Errorf("redis get %s key '%s' failed: %v", datatype, key, err)
+		return err
+	}
+
+	return c.JSON(m)
+}
+
+// string maybe HyperLogLog or bitmap, which is binary and read as count or bits.
+// format=bitmap return bits of window such as '0100'.
+func readString(ctx context.Context, cli redis.Cmdable, key string, start int64,
+	format string, m fiber.Map) error {
+
+	length, err := cli.StrLen(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	m["length"] = length
+
+	// HyperLogLog is string with magic 'HYLL'
+	if length > 4 {
+		if magic, err := cli.GetRange(ctx, key, 0, 3).Result(); err == nil && magic == "HYLL" {
+			m["type"] = "hyperloglog"
+			m["count"], err = cli.PFCount(ctx, key).Result()
 			return err
 		}
-		// log.Tracef("hash key '%s' -> %#v\n", key, val)
+	}
 
-		return c.JSON(val)
+	val, err := cli.GetRange(ctx, key, start, start+REDIS_MAX_STRING-1).Result()
+	if err != nil {
+		return err
+	}
+	m["start"] = start
+	m["truncated"] = start+int64(len(val)) < length
 
-	case "set":
-		val, err := p.cli.SMembers(context.Background(), key).Result()
+	if format == "bitmap" {
+		m["bitcount"], err = cli.BitCount(ctx, key, nil).Result()
+		bits := make([]byte, 0, len(val)*8)
+		for i := 0; i < len(val); i++ {
+			for j := 7; j >= 0; j-- {
+				bits = append(bits, '0'+(val[i]>>j)&1)
+			}
+		}
+		m["value"] = string(bits)
+		return err
+	}
+
+	m["value"] = val
+	return nil
+}
+
+// read stream info, entries from start id, and consumer groups with consumers
+func readStream(ctx context.Context, cli redis.Cmdable, key, start string, count int, m fiber.Map) error {
+	info, err := cli.XInfoStream(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	m["length"] = info.Length
+	m["info"] = info
+
+	entries, err := cli.XRangeN(ctx, key, start, "+", int64(count)).Result()
+	if err != nil {
+		return err
+	}
+	m["start"] = start
+	m["value"] = entries
+	if len(entries) == count {
+		m["next"] = "(" + entries[len(entries)-1].ID // exclusive range of redis 6.2
+	}
+
+	groups, err := cli.XInfoGroups(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	list := make([]fiber.Map, len(groups))
+	for i, group := range groups {
+		consumers, err := cli.XInfoConsumers(ctx, key, group.Name).Result()
 		if err != nil {
-			log.Errorf("redis get key '%s' failed: %v", key, err)
 			return err
 		}
-		// log.Tracef("hash key '%s' -> %#v\n", key, val)
+		list[i] = fiber.Map{"group": group, "consumers": consumers}
+	}
+	m["groups"] = list
 
-		return c.JSON(val)
+	return nil
+}
 
-	case "zset":
-		val, err := p.cli.ZRange(context.Background(), key, 0, -1).Result()
+// SCAN until count keys are found or cursor is back to 0.
+// COUNT of SCAN is just a hint, one call maybe return none or more keys.
+func scanPage(ctx context.Context, cli redis.Cmdable, cursor uint64,
+	match, keytype string, count int) ([]string, uint64, error) {
+
+	keys := make([]string, 0, count)
+	for i := 0; i < REDIS_SCAN_ROUNDS; i++ {
+		var page []string
+		var err error
+		if keytype != "" {
+			page, cursor, err = cli.ScanType(ctx, cursor, match, int64(count-len(keys)), keytype).Result()
+		} else {
+			page, cursor, err = cli.Scan(ctx, cursor, match, int64(count-len(keys))).Result()
+		}
 		if err != nil {
-			log.Errorf("redis get key '%s' failed: %v", key, err)
-			return err
+			return nil, 0, err
+		}
+		keys = append(keys, page...)
+		if cursor == 0 || len(keys) >= count {
+			break
+		}
+	}
+	return keys, cursor, nil
+}
+
+// get TYPE, PTTL, MEMORY USAGE and length of keys by pipeline
+func keysMeta(ctx context.Context, cli redis.Cmdable, keys []string) []redisKey {
+	metas := make([]redisKey, len(keys))
+	if len(keys) == 0 {
+		return metas
+	}
+
+	pipe := cli.Pipeline()
+	types := make([]*redis.StatusCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	memories := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		types[i] = pipe.Type(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+		memories[i] = pipe.MemoryUsage(ctx, key)
+	}
+	pipe.Exec(ctx) // error of every command is checked below, MEMORY maybe disabled
+
+	pipe = cli.Pipeline()
+	lengths := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		metas[i] = redisKey{Key: key, Type: types[i].Val(), Ttl: -1, Memory: -1, Length: -1}
+		if ttl, err := ttls[i].Result(); err == nil {
+			metas[i].Ttl = ttlMillis(ttl)
+		}
+		if memory, err := memories[i].Result(); err == nil {
+			metas[i].Memory = memory
 		}
-		// log.Tracef("hash key '%s' -> %#v\n", key, val)
+		lengths[i] = keyLength(ctx, pipe, key, metas[i].Type)
+	}
+	pipe.Exec(ctx)
 
-		return c.JSON(val)
+	for i := range keys {
+		if lengths[i] != nil {
+			if n, err := lengths[i].Result(); err == nil {
+				metas[i].Length = n
+			}
+		}
+	}
+	return metas
+}
 
+// length of key by type, nil when type is unknown such as module types
+func keyLength(ctx context.Context, cli redis.Cmdable, key, keytype string) *redis.IntCmd {
+	switch keytype {
+	case "string":
+		return cli.StrLen(ctx, key)
+	case "list":
+		return cli.LLen(ctx, key)
+	case "hash":
+		return cli.HLen(ctx, key)
+	case "set":
+		return cli.SCard(ctx, key)
+	case "zset":
+		return cli.ZCard(ctx, key)
+	case "stream":
+		return cli.XLen(ctx, key)
 	default:
-		return fmt.Errorf("unknown key type: %s", datatype)
+		return nil
 	}
+}
 
+// PTTL returns -1 and -2 as special values, not durations of milliseconds
+func ttlMillis(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return int64(ttl)
+	}
+	return ttl.Milliseconds()
 }
 
-func (p *RedisHandler) openRedis() error {
-	cli := redis.NewClient(&redis.Options{
-		Addr:     p.Redisconfig.Addr,
-		Password: p.Redisconfig.Password,
-		DB:       int(p.Redisconfig.Db),
-		Protocol: 3, // specify 2 for RESP 2 or 3 for RESP 3
-	})
+// timeout of redis command, RedisConfig.Timeout in seconds, default 10s
+func (p *RedisHandler) timeout() time.Duration {
+	if p.Redisconfig.Timeout == 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(p.Redisconfig.Timeout) * time.Second
+}
+
+// get client of db index in url /db/:db
+func (p *RedisHandler) getDbClient(c fiber.Ctx) (redis.UniversalClient, error) {
+	db, err := strconv.Atoi(c.Params("db"))
+	if err != nil || db < 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid db '%s'", c.Params("db")))
+	}
+	if p.Redisconfig.Mode == "cluster" && db != 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "redis cluster has only db 0")
+	}
+
+	p.mutex.Lock()
+	cli, ok := p.clis[db]
+	p.mutex.Unlock()
+	if ok {
+		return cli, nil
+	}
+
+	// connect out of lock, so that unreachable db does not block other requests
+	cli, err = p.newClient(db)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if other, ok := p.clis[db]; ok { // connected by another request
+		cli.Close()
+		return other, nil
+	}
+	if p.clis == nil {
+		p.clis = make(map[int]redis.UniversalClient)
+	}
+	p.clis[db] = cli
+	return cli, nil
+}
+
+// client of default db RedisConfig.Db, connected at the first call.
+// p.cli is read and written under p.mutex, handlers and alert engine call it concurrently.
+func (p *RedisHandler) defaultClient() (redis.UniversalClient, error) {
+	p.mutex.Lock()
+	cli := p.cli
+	p.mutex.Unlock()
+	if cli != nil {
+		return cli, nil
+	}
+
+	cli, err := p.newClient(int(p.Redisconfig.Db))
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cli != nil { // connected by another request
+		cli.Close()
+		return p.cli, nil
+	}
+	p.cli = cli
+	return cli, nil
+}
+
+// new client by RedisConfig.Mode, cluster client is routed by slot of key,
+// failover client of sentinel is switched to new master after failover
+func (p *RedisHandler) newClient(db int) (redis.UniversalClient, error) {
+	var cli redis.UniversalClient
+	switch p.Redisconfig.Mode {
+	case "", "standalone":
+		cli = redis.NewClient(&redis.Options{
+			Addr:     p.Redisconfig.Addr,
+			Password: p.Redisconfig.Password,
+			DB:       db,
+			Protocol: 3, // specify 2 for RESP 2 or 3 for RESP 3
+		})
+	case "cluster":
+		cli = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    p.redisAddrs(),
+			Password: p.Redisconfig.Password,
+			Protocol: 3,
+		})
+	case "sentinel":
+		cli = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       p.Redisconfig.MasterName,
+			SentinelAddrs:    p.redisAddrs(),
+			SentinelPassword: p.Redisconfig.SentinelPassword,
+			Password:         p.Redisconfig.Password,
+			DB:               db,
+			Protocol:         3,
+		})
+	default:
+		return nil, fmt.Errorf("unknown redis mode '%s'", p.Redisconfig.Mode)
+	}
 
 	// 测试连接
-	pong, err := cli.Ping(context.Background()).Result()
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+	pong, err := cli.Ping(ctx).Result()
+	if err != nil {
+		log.Errorf("connect redis db %d failed: %v", db, err)
+		cli.Close()
+		return nil, err
+	}
+	log.Debugf("connect redis db %d success: %s", db, pong)
+
+	return cli, nil
+}
+
+// value of alert rule, metric is field of INFO such as used_memory and connected_clients
+func (p *RedisHandler) alertValue(rule *AlertRule) (float64, error) {
+	cli, err := p.defaultClient()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+	info, err := cli.Info(ctx, "all").Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && name == rule.Metric {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	return 0, fmt.Errorf("unknown redis info field '%s'", rule.Metric)
+}
+
+// publish message to channel by default client, such as alert events
+func (p *RedisHandler) publish(channel, message string) error {
+	cli, err := p.defaultClient()
 	if err != nil {
-		log.Errorf("connect redis failed: %v", err)
 		return err
 	}
-	log.Debugf("connect redis success: %s", pong)
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+	return cli.Publish(ctx, channel, message).Err()
+}
 
-	p.cli = cli
-	return nil
+// pool stats of opened clients, key is 'default' or db index of /db/:db
+func (p *RedisHandler) PoolStats() map[string]*redis.PoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := make(map[string]*redis.PoolStats)
+	if p.cli != nil {
+		stats["default"] = p.cli.PoolStats()
+	}
+	for db, cli := range p.clis {
+		stats[strconv.Itoa(db)] = cli.PoolStats()
+	}
+	return stats
 }
 
 func (p *RedisHandler) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for db, cli := range p.clis {
+		cli.Close()
+		delete(p.clis, db)
+	}
 	if p.cli != nil {
 		return p.cli.Close()
 	}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	REDIS_SSE_BUFFER    = 1000             // messages buffered for slow browser, more are dropped
+	REDIS_SSE_HEARTBEAT = 15 * time.Second // ping comment to keep connection alive and find disconnected
+)
+
+// GET /redis/subscribe?channel=a,b&pattern=news.*
+// SUBSCRIBE channels and PSUBSCRIBE patterns, push messages by Server-Sent Events.
+// use EventSource of browser: new EventSource('/redis/subscribe?channel=a').addEventListener('message', ...)
+func (p *RedisHandler) subscribeHandler(c fiber.Ctx) error {
+	channels := splitQuery(c.Query("channel"))
+	patterns := splitQuery(c.Query("pattern"))
+	if len(channels) == 0 && len(patterns) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "channel or pattern is required")
+	}
+	cli, err := p.defaultClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	ps := cli.Subscribe(ctx)
+	if len(channels) > 0 {
+		if err := ps.Subscribe(ctx, channels...); err != nil {
+			ps.Close()
+			return err
+		}
+	}
+	if len(patterns) > 0 {
+		if err := ps.PSubscribe(ctx, patterns...); err != nil {
+			ps.Close()
+			return err
+		}
+	}
+
+	return streamMessages(c, []*redis.PubSub{ps}, fiber.Map{"channels": channels, "patterns": patterns})
+}
+
+// GET /redis/db/:db/events?pattern=user:*&type=keyspace|keyevent
+// keyspace notifications of db, type keyspace is events of keys match pattern,
+// type keyevent is keys of events match pattern such as 'del' and 'expired'.
+// notify-keyspace-events of redis should be set such as 'KEA', or there is no message.
+// keyspace notifications of cluster are sent by each master, so all masters are subscribed.
+func (p *RedisHandler) eventsHandler(c fiber.Ctx) error {
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	pattern := c.Query("pattern", "*")
+	kind := c.Query("type", "keyspace")
+	if kind != "keyspace" && kind != "keyevent" {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid type '%s', should be keyspace or keyevent", kind))
+	}
+	channel := fmt.Sprintf("__%s@%s__:%s", kind, c.Params("db"), pattern)
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	masters, err := masterClients(ctx, cli)
+	if err != nil {
+		return err
+	}
+	hello := fiber.Map{"patterns": []string{channel}}
+	if cfg, err := masters[0].ConfigGet(ctx, "notify-keyspace-events").Result(); err == nil {
+		hello["notify_keyspace_events"] = cfg["notify-keyspace-events"]
+		if cfg["notify-keyspace-events"] == "" {
+			hello["warning"] = "notify-keyspace-events is disabled, set it such as 'KEA' to receive events"
+		}
+	}
+
+	subs := make([]*redis.PubSub, 0, len(masters))
+	for _, master := range masters {
+		ps := master.(redis.UniversalClient).PSubscribe(ctx, channel)
+		if _, err := ps.Receive(ctx); err != nil { // wait for confirmation of subscription
+			ps.Close()
+			for _, sub := range subs {
+				sub.Close()
+			}
+			log.Errorf("redis psubscribe %s failed: %v", channel, err)
+			return err
+		}
+		subs = append(subs, ps)
+	}
+
+	return streamMessages(c, subs, hello)
+}
+
+// push messages of subs by SSE until browser is disconnected, then unsubscribe.
+// messages are buffered up to REDIS_SSE_BUFFER when browser is slow, more are dropped and
+// the number of dropped is sent by event 'dropped', so redis is never blocked by browser.
+func streamMessages(c fiber.Ctx, subs []*redis.PubSub, hello fiber.Map) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // disable buffering of nginx
+
+	ctx, cancel := context.WithCancel(context.Background())
+	buffer := make(chan *redis.Message, REDIS_SSE_BUFFER)
+	var dropped atomic.Int64
+	for _, ps := range subs {
+		go func(ch <-chan *redis.Message) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg, ok := <-ch:
+					if !ok {
+						return
+					}
+					select {
+					case buffer <- msg:
+					default:
+						dropped.Add(1)
+					}
+				}
+			}
+		}(ps.Channel())
+	}
+
+	// WriteTimeout of server is deadline of whole response, extend it for every event
+	conn := c.RequestCtx().Conn()
+	remote := c.IP()
+	log.Infof("redis sse of %s start: %v", remote, hello)
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer func() {
+			cancel()
+			for _, ps := range subs {
+				ps.Close()
+			}
+			log.Infof("redis sse of %s stop, unsubscribed", remote)
+		}()
+
+		write := func(event string, data interface{}) error {
+			conn.SetWriteDeadline(time.Now().Add(2 * REDIS_SSE_HEARTBEAT))
+			if event == "" {
+				w.WriteString(": ping\n\n")
+			} else {
+				b, _ := json.Marshal(data)
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+			}
+			return w.Flush()
+		}
+
+		if err := write("subscribe", hello); err != nil {
+			return
+		}
+		ticker := time.NewTicker(REDIS_SSE_HEARTBEAT)
+		defer ticker.Stop()
+		for {
+			var err error
+			select {
+			case msg := <-buffer:
+				err = write("message", sseMessage(msg))
+			case <-ticker.C:
+				err = write("", nil)
+			}
+			if n := dropped.Swap(0); n > 0 && err == nil {
+				err = write("dropped", fiber.Map{"count": n})
+			}
+			if err != nil { // browser is disconnected
+				return
+			}
+		}
+	})
+}
+
+// message of SSE, key and event are parsed from channel of keyspace notifications
+func sseMessage(msg *redis.Message) fiber.Map {
+	m := fiber.Map{"channel": msg.Channel, "payload": msg.Payload, "time": time.Now().UnixMilli()}
+	if msg.Pattern != "" {
+		m["pattern"] = msg.Pattern
+	}
+	// __keyspace@0__:user:1 with payload 'set', __keyevent@0__:set with payload 'user:1'
+	if prefix, name, ok := strings.Cut(msg.Channel, "__:"); ok {
+		if strings.HasPrefix(prefix, "__keyspace@") {
+			m["key"], m["event"] = name, msg.Payload
+		} else if strings.HasPrefix(prefix, "__keyevent@") {
+			m["key"], m["event"] = msg.Payload, name
+		}
+	}
+	return m
+}
+
+// split query such as 'a,b' and skip empty
+func splitQuery(q string) []string {
+	list := make([]string, 0)
+	for _, s := range strings.Split(q, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
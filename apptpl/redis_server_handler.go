@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// CONFIG whose value is masked, besides names with pass or secret such as requirepass
+var redisSecretConfig = []string{"masterauth", "masteruser"}
+
+// GET /redis/info?section=&node=
+// INFO parsed into sections, such as {"server": {"redis_version": "7.2.4"}, "keyspace": {"db0": {"keys": 1}}}.
+// node is addr of cluster node, default the first master.
+func (p *RedisHandler) infoHandler(c fiber.Ctx) error {
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	sections := []string{}
+	if section := c.Query("section"); section != "" {
+		sections = strings.Split(section, ",")
+	}
+	text, err := node.Info(ctx, sections...).Result()
+	if err != nil {
+		log.Errorf("redis info failed: %v", err)
+		return err
+	}
+
+	return c.JSON(parseInfo(text))
+}
+
+// GET /redis/slowlog?count=128&node=
+func (p *RedisHandler) slowlogHandler(c fiber.Ctx) error {
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	logs, err := node.SlowLogGet(ctx, int64(fiber.Query(c, "count", 128))).Result()
+	if err != nil {
+		log.Errorf("redis slowlog get failed: %v", err)
+		return err
+	}
+	length, _ := node.Do(ctx, "slowlog", "len").Int64()
+
+	list := make([]fiber.Map, len(logs))
+	for i, l := range logs {
+		list[i] = fiber.Map{
+			"id":          l.ID,
+			"time":        l.Time,
+			"duration":    l.Duration.Microseconds(), // in microseconds
+			"args":        l.Args,
+			"client_addr": l.ClientAddr,
+			"client_name": l.ClientName,
+		}
+	}
+	return c.JSON(fiber.Map{"len": length, "logs": list})
+}
+
+// GET /redis/clients?node=, CLIENT LIST parsed, sort by idle desc, admin only
+func (p *RedisHandler) clientsHandler(c fiber.Ctx) error {
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	text, err := node.ClientList(ctx).Result()
+	if err != nil {
+		log.Errorf("redis client list failed: %v", err)
+		return err
+	}
+
+	// id=3 addr=127.0.0.1:50188 laddr=127.0.0.1:6379 fd=8 name= age=0 idle=0 flags=N db=0 ... cmd=client|list
+	clients := make([]fiber.Map, 0)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m := fiber.Map{}
+		for _, field := range strings.Split(line, " ") {
+			k, v, _ := strings.Cut(field, "=")
+			m[k] = infoValue(v)
+		}
+		clients = append(clients, m)
+	}
+	sort.SliceStable(clients, func(i, j int) bool {
+		a, _ := clients[i]["idle"].(int64)
+		b, _ := clients[j]["idle"].(int64)
+		return a > b
+	})
+
+	return c.JSON(clients)
+}
+
+// DELETE /redis/clients/:id?node=, CLIENT KILL ID, admin only
+func (p *RedisHandler) clientKillHandler(c fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid client id '%s'", id))
+	}
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	n, err := node.ClientKillByFilter(ctx, "ID", id).Result()
+	detail := fiber.Map{"node": c.Query("node"), "killed": n}
+	if err != nil {
+		detail["error"] = err.Error()
+	}
+	auditLog(c, "redis", "client_kill", id, detail)
+	if err != nil {
+		log.Errorf("redis client kill %s failed: %v", id, err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if n == 0 {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("client '%s' not found", id))
+	}
+
+	return c.JSON(fiber.Map{"id": id, "killed": n})
+}
+
+// GET /redis/latency?event=&node=
+// LATENCY LATEST of all events, or LATENCY HISTORY of event. latency in milliseconds,
+// latency-monitor-threshold should be set, or it is empty.
+func (p *RedisHandler) latencyHandler(c fiber.Ctx) error {
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	if event := c.Query("event"); event != "" {
+		// [[timestamp, latency], ...]
+		vals, err := node.Do(ctx, "latency", "history", event).Slice()
+		if err != nil {
+			log.Errorf("redis latency history %s failed: %v", event, err)
+			return err
+		}
+		history := make([]fiber.Map, 0, len(vals))
+		for _, val := range vals {
+			if pair, ok := val.([]interface{}); ok && len(pair) == 2 {
+				history = append(history, fiber.Map{"time": pair[0], "latency": pair[1]})
+			}
+		}
+		return c.JSON(fiber.Map{"event": event, "history": history})
+	}
+
+	latest, err := node.Latency(ctx).Result()
+	if err != nil {
+		log.Errorf("redis latency latest failed: %v", err)
+		return err
+	}
+	events := make([]fiber.Map, len(latest))
+	for i, l := range latest {
+		events[i] = fiber.Map{
+			"event":  l.Name,
+			"time":   l.Time,
+			"latest": l.Latest.Milliseconds(),
+			"max":    l.Max.Milliseconds(),
+		}
+	}
+	threshold := ""
+	if cfg, err := node.ConfigGet(ctx, "latency-monitor-threshold").Result(); err == nil {
+		threshold = cfg["latency-monitor-threshold"]
+	}
+
+	return c.JSON(fiber.Map{"threshold": threshold, "events": events})
+}
+
+// GET /redis/config?pattern=*&node=, CONFIG GET, values of password are masked, admin only
+func (p *RedisHandler) configHandler(c fiber.Ctx) error {
+	node, err := p.nodeClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	cfg, err := node.ConfigGet(ctx, c.Query("pattern", "*")).Result()
+	if err != nil {
+		log.Errorf("redis config get failed: %v", err)
+		return err
+	}
+	for k, v := range cfg {
+		if v != "" && (slices.Contains(redisSecretConfig, k) ||
+			strings.Contains(k, "pass") || strings.Contains(k, "secret")) {
+			cfg[k] = "******"
+		}
+	}
+
+	return c.JSON(cfg)
+}
+
+// parse INFO into map of sections, section name is lower case.
+// value such as 'keys=1,expires=0' of keyspace, cmdstat and errorstat is parsed into map.
+func parseInfo(text string) fiber.Map {
+	info := fiber.Map{}
+	section := fiber.Map{}
+	info["default"] = section
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			section = fiber.Map{}
+			info[strings.ToLower(strings.TrimSpace(line[1:]))] = section
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if strings.Contains(v, "=") {
+			m := fiber.Map{}
+			for _, field := range strings.Split(v, ",") {
+				fk, fv, _ := strings.Cut(field, "=")
+				m[fk] = infoValue(fv)
+			}
+			section[k] = m
+		} else {
+			section[k] = infoValue(v)
+		}
+	}
+	if len(info["default"].(fiber.Map)) == 0 {
+		delete(info, "default")
+	}
+	return info
+}
+
+// number of INFO or CLIENT LIST, or the string itself
+func infoValue(v string) interface{} {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	return v
+}
+
+// client of the server to diagnose. for cluster, it is the node of query 'node' (master or replica),
+// default the first master sort by addr.
+func (p *RedisHandler) nodeClient(c fiber.Ctx) (redis.UniversalClient, error) {
+	cli, err := p.defaultClient()
+	if err != nil {
+		return nil, err
+	}
+	cluster, ok := cli.(*redis.ClusterClient)
+	if !ok {
+		return cli, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	addr := c.Query("node")
+	if addr == "" {
+		masters, err := masterClients(ctx, cluster)
+		if err != nil {
+			return nil, err
+		}
+		return masters[0].(*redis.Client), nil
+	}
+
+	var node *redis.Client
+	var mutex sync.Mutex
+	err = cluster.ForEachShard(ctx, func(ctx context.Context, shard *redis.Client) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if shard.Options().Addr == addr {
+			node = shard
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("cluster node '%s' not found", addr))
+	}
+	return node, nil
+}
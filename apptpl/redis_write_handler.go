@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	REDIS_EXPORT_KEYS = 1000 // default max keys of export
+)
+
+// key of export and import, also body of PUT /redis/db/:db/key/:key.
+// value of string is string, list and set are []string, hash is map[string]string,
+// zset is [{member, score}], stream is [{id, values}].
+// encoding is 'base64' when string is not utf-8, or 'dump' when value is base64 of DUMP,
+// which is used by module types such as ReJSON-RL and binary elements of other types.
+type redisRecord struct {
+	Key      string          `json:"key,omitempty"`
+	Type     string          `json:"type"`
+	Ttl      int64           `json:"ttl"` // milliseconds, -1 or 0 means no expire
+	Encoding string          `json:"encoding,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// audit target of key, such as 'db0/user:1'
+func auditKey(c fiber.Ctx, key string) string {
+	return "db" + c.Params("db") + "/" + key
+}
+
+func keyParam(c fiber.Ctx) (string, error) {
+	key, _ := url.QueryUnescape(c.Params("key"))
+	if key == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, "key is required")
+	}
+	return key, nil
+}
+
+// PUT /redis/db/:db/key/:key, body is {"type": "hash", "value": {"f1": "v1"}, "ttl": 60000}.
+// key is replaced by the new value in transaction.
+func (p *RedisHandler) setHandler(c fiber.Ctx) error {
+	key, err := keyParam(c)
+	if err != nil {
+		return err
+	}
+	rec := redisRecord{}
+	if err = json.Unmarshal(c.Body(), &rec); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+	rec.Key = key
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	if err = writeRecord(ctx, cli, &rec, true); err != nil {
+		log.Errorf("redis set key '%s' failed: %v", key, err)
+		auditLog(c, "redis", "set", auditKey(c, key), fiber.Map{"type": rec.Type, "error": err.Error()})
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	auditLog(c, "redis", "set", auditKey(c, key), fiber.Map{"type": rec.Type, "ttl": rec.Ttl})
+
+	return c.JSON(fiber.Map{"key": key, "type": rec.Type, "ttl": rec.Ttl})
+}
+
+// POST /redis/db/:db/key/:key/expire?ttl=60, ttl in seconds
+func (p *RedisHandler) expireHandler(c fiber.Ctx) error {
+	key, err := keyParam(c)
+	if err != nil {
+		return err
+	}
+	ttl := fiber.Query(c, "ttl", 0)
+	if ttl <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "ttl should be positive seconds, use persist to remove expire")
+	}
+
+	return p.keyCommand(c, "expire", key, fiber.Map{"ttl": ttl},
+		func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+			return cli.Expire(ctx, key, time.Duration(ttl)*time.Second).Result()
+		})
+}
+
+// POST /redis/db/:db/key/:key/persist
+func (p *RedisHandler) persistHandler(c fiber.Ctx) error {
+	key, err := keyParam(c)
+	if err != nil {
+		return err
+	}
+
+	return p.keyCommand(c, "persist", key, nil,
+		func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+			return cli.Persist(ctx, key).Result()
+		})
+}
+
+// POST /redis/db/:db/key/:key/rename?to=newkey&nx=true, nx means not overwrite existed key
+func (p *RedisHandler) renameHandler(c fiber.Ctx) error {
+	key, err := keyParam(c)
+	if err != nil {
+		return err
+	}
+	to := c.Query("to")
+	if to == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "new key name 'to' is required")
+	}
+	nx := fiber.Query(c, "nx", false)
+
+	return p.keyCommand(c, "rename", key, fiber.Map{"to": to, "nx": nx},
+		func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+			if nx {
+				return cli.RenameNX(ctx, key, to).Result()
+			}
+			_, err := cli.Rename(ctx, key, to).Result()
+			return err == nil, err
+		})
+}
+
+// DELETE /redis/db/:db/key/:key, use UNLINK to free memory in background
+func (p *RedisHandler) deleteHandler(c fiber.Ctx) error {
+	key, err := keyParam(c)
+	if err != nil {
+		return err
+	}
+
+	return p.keyCommand(c, "delete", key, nil,
+		func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+			n, err := cli.Unlink(ctx, key).Result()
+			return n > 0, err
+		})
+}
+
+// run command of one key, write audit log. return 404 when key not existed, or 409 when rename nx failed
+func (p *RedisHandler) keyCommand(c fiber.Ctx, action, key string, detail fiber.Map,
+	fn func(ctx context.Context, cli redis.UniversalClient) (bool, error)) error {
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+	defer cancel()
+
+	if detail == nil {
+		detail = fiber.Map{}
+	}
+	ok, err := fn(ctx, cli)
+	if err != nil {
+		detail["error"] = err.Error()
+		auditLog(c, "redis", action, auditKey(c, key), detail)
+		if err == redis.Nil || err.Error() == "ERR no such key" {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("key '%s' not found", key))
+		}
+		log.Errorf("redis %s key '%s' failed: %v", action, key, err)
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	detail["ok"] = ok
+	auditLog(c, "redis", action, auditKey(c, key), detail)
+
+	if !ok {
+		if action == "rename" {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("key '%s' is existed", c.Query("to")))
+		}
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("key '%s' not found or has no expire", key))
+	}
+	return c.JSON(fiber.Map{"key": key, "action": action, "ok": ok})
+}
+
+// DELETE /redis/db/:db/keys?match=user:*
+// delete keys by pattern in background job, SCAN and UNLINK by batch. progress by GET /jobs/:id
+func (p *RedisHandler) deleteKeysHandler(c fiber.Ctx) error {
+	match := c.Query("match")
+	if match == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "match pattern is required, such as 'user:*'")
+	}
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+
+	target := auditKey(c, match)
+	auditLog(c, "redis", "delete_keys", target, nil)
+	job := p.Jobs.Start(c, "redis_delete", target, func(ctx context.Context, job *Job) (interface{}, error) {
+		var total int64
+		if match == "*" {
+			total, _ = cli.DBSize(ctx).Result()
+		}
+		job.SetProgress(0, total, "scan "+match)
+
+		// UNLINK one key per command in pipeline, keys in different slots can not be in one command of cluster
+		_, err := scanAll(ctx, cli, match, func(node redis.Cmdable, keys []string) (bool, error) {
+			pipe := node.Pipeline()
+			cmds := make([]*redis.IntCmd, len(keys))
+			for i, key := range keys {
+				cmds[i] = pipe.Unlink(ctx, key)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return true, err
+			}
+			for _, cmd := range cmds {
+				job.AddDone(cmd.Val())
+			}
+			return false, nil
+		})
+		return nil, err
+	})
+
+	return c.Status(fiber.StatusAccepted).JSON(job.info())
+}
+
+// GET /redis/db/:db/export?match=*&limit=1000, limit is 1 to 100000
+// export keys of all types as json array of redisRecord, which can be imported by POST /redis/db/:db/import
+func (p *RedisHandler) exportHandler(c fiber.Ctx) error {
+	match := c.Query("match", "*")
+	limit, err := queryBetween(c, "limit", REDIS_EXPORT_KEYS, REDIS_SAMPLE_KEYS)
+	if err != nil {
+		return err
+	}
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*p.timeout())
+	defer cancel()
+
+	records := make([]*redisRecord, 0)
+	_, err = scanAll(ctx, cli, match, func(node redis.Cmdable, keys []string) (bool, error) {
+		for _, key := range keys {
+			if len(records) >= limit {
+				break
+			}
+			rec, err := readRecord(ctx, cli, key)
+			if err == redis.Nil { // deleted after scan
+				continue
+			}
+			if err != nil {
+				log.Errorf("redis export key '%s' failed: %v", key, err)
+				return true, err
+			}
+			records = append(records, rec)
+		}
+		return len(records) >= limit, nil
+	})
+	if err != nil {
+		log.Errorf("redis scan export of '%s' failed: %v", match, err)
+		return err
+	}
+	auditLog(c, "redis", "export", auditKey(c, match), fiber.Map{"keys": len(records)})
+
+	c.Attachment(fmt.Sprintf("redis_db%s_%s.json", c.Params("db"), time.Now().Format("20060102150405")))
+	return c.JSON(records)
+}
+
+// POST /redis/db/:db/import?replace=false, body is json array of redisRecord.
+// existed keys are skipped, or replaced when replace=true.
+func (p *RedisHandler) importHandler(c fiber.Ctx) error {
+	replace := fiber.Query(c, "replace", false)
+	records := make([]*redisRecord, 0)
+	if err := json.Unmarshal(c.Body(), &records); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json body: "+err.Error())
+	}
+
+	cli, err := p.getDbClient(c)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*p.timeout())
+	defer cancel()
+
+	imported, skipped := 0, 0
+	errs := make([]fiber.Map, 0)
+	for i, rec := range records {
+		if rec.Key == "" {
+			errs = append(errs, fiber.Map{"index": i, "error": "key is required"})
+			continue
+		}
+		if !replace {
+			n, err := cli.Exists(ctx, rec.Key).Result()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				skipped++
+				continue
+			}
+		}
+		if err := writeRecord(ctx, cli, rec, replace); err != nil {
+			errs = append(errs, fiber.Map{"index": i, "key": rec.Key, "error": err.Error()})
+			continue
+		}
+		imported++
+	}
+
+	result := fiber.Map{"total": len(records), "imported": imported, "skipped": skipped, "errors": errs}
+	auditLog(c, "redis", "import", "db"+c.Params("db"),
+		fiber.Map{"total": len(records), "imported": imported, "skipped": skipped, "errors": len(errs), "replace": replace})
+	if len(errs) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// read whole value of key as redisRecord, return redis.Nil when key not existed
+func readRecord(ctx context.Context, cli redis.Cmdable, key string) (*redisRecord, error) {
+	keytype, err := cli.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if keytype == "none" {
+		return nil, redis.Nil
+	}
+	ttl, err := cli.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	rec := &redisRecord{Key: key, Type: keytype, Ttl: ttlMillis(ttl)}
+
+	var value interface{}
+	switch keytype {
+	case "string":
+		s, err := cli.Get(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if utf8.ValidString(s) {
+			value = s
+		} else {
+			rec.Encoding = "base64"
+			value = base64.StdEncoding.EncodeToString([]byte(s))
+		}
+	case "list":
+		value, err = cli.LRange(ctx, key, 0, -1).Result()
+	case "hash":
+		value, err = cli.HGetAll(ctx, key).Result()
+	case "set":
+		value, err = cli.SMembers(ctx, key).Result()
+	case "zset":
+		var zs []redis.Z
+		zs, err = cli.ZRangeWithScores(ctx, key, 0, -1).Result()
+		members := make([]fiber.Map, len(zs))
+		for i, z := range zs {
+			members[i] = fiber.Map{"member": z.Member, "score": z.Score}
+		}
+		value = members
+	case "stream":
+		var msgs []redis.XMessage
+		msgs, err = cli.XRange(ctx, key, "-", "+").Result()
+		entries := make([]fiber.Map, len(msgs))
+		for i, msg := range msgs {
+			entries[i] = fiber.Map{"id": msg.ID, "values": msg.Values}
+		}
+		value = entries
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// module types and binary elements, which can not be presented in json, are exported by DUMP
+	if value == nil || (keytype != "string" && !validUtf8(value)) {
+		dump, err := cli.Dump(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		rec.Encoding = "dump"
+		value = base64.StdEncoding.EncodeToString([]byte(dump))
+	}
+
+	if rec.Value, err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// check strings of list, set, hash, zset and stream are utf-8
+func validUtf8(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return utf8.ValidString(v)
+	case []string:
+		for _, s := range v {
+			if !utf8.ValidString(s) {
+				return false
+			}
+		}
+	case map[string]string:
+		for k, s := range v {
+			if !utf8.ValidString(k) || !utf8.ValidString(s) {
+				return false
+			}
+		}
+	case map[string]interface{}:
+		for k, s := range v {
+			if !utf8.ValidString(k) || !validUtf8(s) {
+				return false
+			}
+		}
+	case []fiber.Map:
+		for _, m := range v {
+			if !validUtf8(map[string]interface{}(m)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// write redisRecord to key in transaction, old value is deleted when replace
+func writeRecord(ctx context.Context, cli redis.Cmdable, rec *redisRecord, replace bool) error {
+	var ttl time.Duration
+	if rec.Ttl > 0 {
+		ttl = time.Duration(rec.Ttl) * time.Millisecond
+	}
+
+	if rec.Encoding == "dump" {
+		var s string
+		if err := json.Unmarshal(rec.Value, &s); err != nil {
+			return fmt.Errorf("value of dump should be base64 string: %v", err)
+		}
+		dump, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("value of dump should be base64 string: %v", err)
+		}
+		if replace {
+			return cli.RestoreReplace(ctx, rec.Key, ttl, string(dump)).Err()
+		}
+		return cli.Restore(ctx, rec.Key, ttl, string(dump)).Err()
+	}
+
+	pipe := cli.TxPipeline()
+	if replace {
+		pipe.Del(ctx, rec.Key)
+	}
+	switch rec.Type {
+	case "string":
+		var s string
+		if err := json.Unmarshal(rec.Value, &s); err != nil {
+			return fmt.Errorf("value of string should be string: %v", err)
+		}
+		if rec.Encoding == "base64" {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("value of base64 encoding is invalid: %v", err)
+			}
+			s = string(b)
+		}
+		pipe.Set(ctx, rec.Key, s, 0)
+	case "list", "set":
+		var items []string
+		if err := json.Unmarshal(rec.Value, &items); err != nil || len(items) == 0 {
+			return fmt.Errorf("value of %s should be array of string and not empty", rec.Type)
+		}
+		args := make([]interface{}, len(items))
+		for i, item := range items {
+			args[i] = item
+		}
+		if rec.Type == "list" {
+			pipe.RPush(ctx, rec.Key, args...)
+		} else {
+			pipe.SAdd(ctx, rec.Key, args...)
+		}
+	case "hash":
+		var fields map[string]string
+		if err := json.Unmarshal(rec.Value, &fields); err != nil || len(fields) == 0 {
+			return fmt.Errorf("value of hash should be object of string and not empty")
+		}
+		pipe.HSet(ctx, rec.Key, fields)
+	case "zset":
+		var members []struct {
+			Member string  `json:"member"`
+			Score  float64 `json:"score"`
+		}
+		if err := json.Unmarshal(rec.Value, &members); err != nil || len(members) == 0 {
+			return fmt.Errorf("value of zset should be array of {member, score} and not empty")
+		}
+		zs := make([]redis.Z, len(members))
+		for i, m := range members {
+			zs[i] = redis.Z{Member: m.Member, Score: m.Score}
+		}
+		pipe.ZAdd(ctx, rec.Key, zs...)
+	case "stream":
+		var entries []struct {
+			Id     string                 `json:"id"`
+			Values map[string]interface{} `json:"values"`
+		}
+		if err := json.Unmarshal(rec.Value, &entries); err != nil || len(entries) == 0 {
+			return fmt.Errorf("value of stream should be array of {id, values} and not empty")
+		}
+		for _, entry := range entries {
+			id := entry.Id
+			if id == "" {
+				id = "*"
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: rec.Key, ID: id, Values: entry.Values})
+		}
+	default:
+		return fmt.Errorf("type '%s' is not supported, use encoding 'dump' of export", rec.Type)
+	}
+	if ttl > 0 {
+		pipe.PExpire(ctx, rec.Key, ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	log "github.com/sirupsen/logrus"
+
+	"goapptol/utils"
+)
+
+const (
+	// snapshot id is capture time with nanoseconds, so that captures of the same second are kept.
+	// trailing zeros of fraction are removed, ids of second only are still valid and sorted.
+	SCHEMA_ID_FORMAT = "20060102150405.999999999"
+)
+
+type SchemaColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable string `json:"nullable"`
+	Default  string `json:"default"`
+}
+
+type SchemaIndex struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"` // such as 'UNIQUE (a,b)' or indexdef of postgresql
+}
+
+type SchemaTable struct {
+	Name    string         `json:"name"`
+	Type    string         `json:"type"` // BASE TABLE, VIEW, or engine of clickhouse
+	Columns []SchemaColumn `json:"columns"`
+	Indexes []SchemaIndex  `json:"indexes"`
+	Ddl     string         `json:"ddl"`
+}
+
+// schema of one datasource at capture time
+type SchemaSnapshot struct {
+	Id       string        `json:"id"`
+	Dbtype   string        `json:"dbtype"`
+	Database string        `json:"database"`
+	Time     time.Time     `json:"time"`
+	Hash     string        `json:"hash"` // sha256 of tables, same hash means not changed
+	Tables   []SchemaTable `json:"tables,omitempty"`
+}
+
+// capture schema snapshot of datasources periodically, and save to local directory
+// <path>/<name>/<id>.json when schema is changed.
+type SchemaTracker struct {
+	Schemaconfig *SchemaConfig
+	sources      map[string]func() (*SchemaSnapshot, error)
+	mutex        sync.Mutex
+	done         chan struct{}
+}
+
+// r := app.Group("/mysql/schema"), name is sub directory of snapshots such as mysql
+func (p *SchemaTracker) AddRouter(r fiber.Router, name string,
+	snapshot func() (*SchemaSnapshot, error)) error {
+
+	log.Infof("SchemaTracker AddRouter of %s", name)
+	if p.sources == nil {
+		p.sources = make(map[string]func() (*SchemaSnapshot, error))
+	}
+	p.sources[name] = snapshot
+
+	r.Get("/history", p.historyHandler(name))
+	r.Get("/diff", p.diffHandler(name))
+	r.Get("/snapshot/:id", p.snapshotHandler(name))
+	r.Post("/snapshot", adminOnly, p.captureHandler(name))
+
+	return nil
+}
+
+// capture all datasources at start and then every interval
+func (p *SchemaTracker) Start() error {
+	if !p.Schemaconfig.Enable {
+		log.Info("schema tracker is disabled")
+		return nil
+	}
+	interval, err := time.ParseDuration(p.Schemaconfig.Interval)
+	if err != nil {
+		return fmt.Errorf("parse schema.interval [%s] failed: %s", p.Schemaconfig.Interval, err)
+	}
+
+	p.done = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.captureAll()
+			select {
+			case <-ticker.C:
+			case <-p.done:
+				log.Debug("schema tracker stop")
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (p *SchemaTracker) Stop() {
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+}
+
+func (p *SchemaTracker) captureAll() {
+	for name := range p.sources {
+		if _, _, err := p.capture(name); errors.Is(err, errDsnEmpty) {
+			log.Debugf("skip schema of %s: %v", name, err)
+		} else if err != nil {
+			log.Warnf("capture schema of %s failed: %v", name, err)
+		}
+	}
+}
+
+// capture snapshot of datasource, save it when changed. return snapshot and saved or not
+func (p *SchemaTracker) capture(name string) (*SchemaSnapshot, bool, error) {
+	snapshot, err := p.sources[name]()
+	if err != nil {
+		return nil, false, err
+	}
+	snapshot.Time = time.Now()
+	snapshot.Id = snapshot.Time.Format(SCHEMA_ID_FORMAT)
+	b, _ := json.Marshal(snapshot.Tables)
+	sum := sha256.Sum256(b)
+	snapshot.Hash = hex.EncodeToString(sum[:])
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ids, err := p.listIds(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(ids) > 0 {
+		last, err := p.load(name, ids[len(ids)-1])
+		if err == nil && last.Hash == snapshot.Hash {
+			log.Tracef("schema of %s not changed since %s", name, last.Id)
+			return last, false, nil
+		}
+	}
+
+	dir := filepath.Join(p.Schemaconfig.Path, name)
+	if err = utils.CheckMakeDir(dir); err != nil {
+		return nil, false, err
+	}
+	b, _ = json.MarshalIndent(snapshot, "", " ")
+	if err = os.WriteFile(filepath.Join(dir, snapshot.Id+".json"), b, 0644); err != nil {
+		return nil, false, err
+	}
+	log.Infof("schema of %s changed, save snapshot %s", name, snapshot.Id)
+
+	// remove the oldest snapshots
+	ids = append(ids, snapshot.Id)
+	if p.Schemaconfig.Keep > 0 && len(ids) > p.Schemaconfig.Keep {
+		for _, id := range ids[:len(ids)-p.Schemaconfig.Keep] {
+			os.Remove(filepath.Join(dir, id+".json"))
+		}
+	}
+
+	return snapshot, true, nil
+}
+
+// ids of snapshots sort by time
+func (p *SchemaTracker) listIds(name string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(p.Schemaconfig.Path, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (p *SchemaTracker) load(name, id string) (*SchemaSnapshot, error) {
+	if _, err := time.Parse(SCHEMA_ID_FORMAT, id); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid snapshot id '%s'", id))
+	}
+	b, err := os.ReadFile(filepath.Join(p.Schemaconfig.Path, name, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("snapshot '%s' not found", id))
+		}
+		return nil, err
+	}
+
+	snapshot := &SchemaSnapshot{}
+	if err = json.Unmarshal(b, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GET /mysql/schema/history, list snapshots without tables
+func (p *SchemaTracker) historyHandler(name string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		ids, err := p.listIds(name)
+		if err != nil {
+			return err
+		}
+		history := make([]fiber.Map, 0, len(ids))
+		for i := len(ids) - 1; i >= 0; i-- { // the latest first
+			snapshot, err := p.load(name, ids[i])
+			if err != nil {
+				log.Warnf("load schema snapshot %s/%s failed: %v", name, ids[i], err)
+				continue
+			}
+			history = append(history, fiber.Map{
+				"id":       snapshot.Id,
+				"time":     snapshot.Time,
+				"database": snapshot.Database,
+				"hash":     snapshot.Hash,
+				"tables":   len(snapshot.Tables),
+			})
+		}
+		return c.JSON(history)
+	}
+}
+
+// GET /mysql/schema/snapshot/:id
+func (p *SchemaTracker) snapshotHandler(name string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		snapshot, err := p.load(name, c.Params("id"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(snapshot)
+	}
+}
+
+// POST /mysql/schema/snapshot, capture now, admin role only
+func (p *SchemaTracker) captureHandler(name string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		snapshot, saved, err := p.capture(name)
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"id": snapshot.Id, "time": snapshot.Time, "hash": snapshot.Hash, "saved": saved})
+	}
+}
+
+// GET /mysql/schema/diff?from=&to=, default from the previous to the latest snapshot
+func (p *SchemaTracker) diffHandler(name string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		ids, err := p.listIds(name)
+		if err != nil {
+			return err
+		}
+		from, to := c.Query("from"), c.Query("to")
+		if to == "" && len(ids) > 0 {
+			to = ids[len(ids)-1]
+		}
+		if from == "" {
+			if i := slices.Index(ids, to); i > 0 {
+				from = ids[i-1]
+			}
+		}
+		if from == "" || to == "" {
+			return fiber.NewError(fiber.StatusNotFound, "need two snapshots to diff")
+		}
+
+		s0, err := p.load(name, from)
+		if err != nil {
+			return err
+		}
+		s1, err := p.load(name, to)
+		if err != nil {
+			return err
+		}
+		return c.JSON(diffSchema(s0, s1))
+	}
+}
+
+type schemaChange struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type tableDiff struct {
+	Name           string         `json:"name"`
+	AddedColumns   []SchemaColumn `json:"added_columns,omitempty"`
+	DroppedColumns []SchemaColumn `json:"dropped_columns,omitempty"`
+	ChangedColumns []schemaChange `json:"changed_columns,omitempty"`
+	AddedIndexes   []SchemaIndex  `json:"added_indexes,omitempty"`
+	DroppedIndexes []SchemaIndex  `json:"dropped_indexes,omitempty"`
+	ChangedIndexes []schemaChange `json:"changed_indexes,omitempty"`
+	TypeChanged    *schemaChange  `json:"type_changed,omitempty"`
+	DdlChanged     *schemaChange  `json:"ddl_changed,omitempty"`
+}
+
+type schemaDiff struct {
+	From          string      `json:"from"`
+	To            string      `json:"to"`
+	FromTime      time.Time   `json:"from_time"`
+	ToTime        time.Time   `json:"to_time"`
+	AddedTables   []string    `json:"added_tables"`
+	DroppedTables []string    `json:"dropped_tables"`
+	ChangedTables []tableDiff `json:"changed_tables"`
+}
+
+func diffSchema(s0, s1 *SchemaSnapshot) *schemaDiff {
+	d := &schemaDiff{From: s0.Id, To: s1.Id, FromTime: s0.Time, ToTime: s1.Time,
+		AddedTables: []string{}, DroppedTables: []string{}, ChangedTables: []tableDiff{}}
+
+	tables0 := make(map[string]*SchemaTable, len(s0.Tables))
+	for i := range s0.Tables {
+		tables0[s0.Tables[i].Name] = &s0.Tables[i]
+	}
+	for i := range s1.Tables {
+		t1 := &s1.Tables[i]
+		t0, ok := tables0[t1.Name]
+		if !ok {
+			d.AddedTables = append(d.AddedTables, t1.Name)
+			continue
+		}
+		delete(tables0, t1.Name)
+		if td := diffTable(t0, t1); td != nil {
+			d.ChangedTables = append(d.ChangedTables, *td)
+		}
+	}
+	for name := range tables0 {
+		d.DroppedTables = append(d.DroppedTables, name)
+	}
+	sort.Strings(d.DroppedTables)
+
+	return d
+}
+
+// return nil when table is not changed
+func diffTable(t0, t1 *SchemaTable) *tableDiff {
+	td := &tableDiff{Name: t1.Name}
+	changed := false
+
+	columns0 := make(map[string]SchemaColumn, len(t0.Columns))
+	for _, col := range t0.Columns {
+		columns0[col.Name] = col
+	}
+	for _, col := range t1.Columns {
+		col0, ok := columns0[col.Name]
+		if !ok {
+			td.AddedColumns = append(td.AddedColumns, col)
+			changed = true
+			continue
+		}
+		delete(columns0, col.Name)
+		if col0 != col {
+			b0, _ := json.Marshal(col0)
+			b1, _ := json.Marshal(col)
+			td.ChangedColumns = append(td.ChangedColumns, schemaChange{Name: col.Name, From: string(b0), To: string(b1)})
+			changed = true
+		}
+	}
+	for _, col := range t0.Columns { // keep order of columns
+		if _, ok := columns0[col.Name]; ok {
+			td.DroppedColumns = append(td.DroppedColumns, col)
+			changed = true
+		}
+	}
+
+	indexes0 := make(map[string]SchemaIndex, len(t0.Indexes))
+	for _, idx := range t0.Indexes {
+		indexes0[idx.Name] = idx
+	}
+	for _, idx := range t1.Indexes {
+		idx0, ok := indexes0[idx.Name]
+		if !ok {
+			td.AddedIndexes = append(td.AddedIndexes, idx)
+			changed = true
+			continue
+		}
+		delete(indexes0, idx.Name)
+		if idx0.Definition != idx.Definition {
+			td.ChangedIndexes = append(td.ChangedIndexes, schemaChange{Name: idx.Name, From: idx0.Definition, To: idx.Definition})
+			changed = true
+		}
+	}
+	for _, idx := range t0.Indexes {
+		if _, ok := indexes0[idx.Name]; ok {
+			td.DroppedIndexes = append(td.DroppedIndexes, idx)
+			changed = true
+		}
+	}
+
+	if t0.Type != t1.Type {
+		td.TypeChanged = &schemaChange{Name: t1.Name, From: t0.Type, To: t1.Type}
+		changed = true
+	}
+	if t0.Ddl != t1.Ddl {
+		td.DdlChanged = &schemaChange{Name: t1.Name, From: t0.Ddl, To: t1.Ddl}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return td
+}
+
+// build snapshot from query result of datasource.
+// tables is [name, type], columns is [table, name, type, nullable, default],
+// indexes is [table, name, definition], ddls is [table, ddl]
+func buildSnapshot(dbtype, database string, tables, columns, indexes, ddls [][]string) *SchemaSnapshot {
+	snapshot := &SchemaSnapshot{Dbtype: dbtype, Database: database, Tables: make([]SchemaTable, 0, len(tables))}
+	pos := make(map[string]int, len(tables)) // table name -> index of snapshot.Tables
+	for _, row := range tables {
+		pos[row[0]] = len(snapshot.Tables)
+		snapshot.Tables = append(snapshot.Tables, SchemaTable{Name: row[0], Type: row[1],
+			Columns: []SchemaColumn{}, Indexes: []SchemaIndex{}})
+	}
+
+	for _, row := range columns {
+		if i, ok := pos[row[0]]; ok {
+			snapshot.Tables[i].Columns = append(snapshot.Tables[i].Columns,
+				SchemaColumn{Name: row[1], Type: row[2], Nullable: row[3], Default: row[4]})
+		}
+	}
+	for _, row := range indexes {
+		if i, ok := pos[row[0]]; ok {
+			snapshot.Tables[i].Indexes = append(snapshot.Tables[i].Indexes,
+				SchemaIndex{Name: row[1], Definition: row[2]})
+		}
+	}
+	for _, row := range ddls {
+		if i, ok := pos[row[0]]; ok {
+			snapshot.Tables[i].Ddl = row[1]
+		}
+	}
+
+	// indexes order is not stable in information_schema
+	for i := range snapshot.Tables {
+		sort.Slice(snapshot.Tables[i].Indexes, func(a, b int) bool {
+			return snapshot.Tables[i].Indexes[a].Name < snapshot.Tables[i].Indexes[b].Name
+		})
+	}
+	return snapshot
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"goapptol/utils"
+)
+
+func TestReadRecordsCsv(t *testing.T) {
+	data := "\ufeffid, name ,age\n1,tom,20\n\n2,\"jerry, jr\"\n"
+	lines := make([]int, 0)
+	records := make([]map[string]interface{}, 0)
+	err := utils.ReadRecords("users.csv", strings.NewReader(data), func(line int, record map[string]interface{}) error {
+		lines = append(lines, line)
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRecords csv error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadRecords csv want 2 records, got %d", len(records))
+	}
+	if lines[0] != 2 || lines[1] != 4 {
+		t.Errorf("ReadRecords csv lines want [2 4], got %v", lines)
+	}
+	if records[0]["id"] != "1" || records[0]["name"] != "tom" || records[0]["age"] != "20" {
+		t.Errorf("ReadRecords csv record 0: %v", records[0])
+	}
+	if records[1]["name"] != "jerry, jr" || records[1]["age"] != "" {
+		t.Errorf("ReadRecords csv record 1: %v", records[1])
+	}
+}
+
+func TestReadRecordsNdjson(t *testing.T) {
+	data := `{"id": 1, "name": "tom", "tags": ["a"]}
+
+{"id": 12345678901234567890, "name": null}
+`
+	records := make([]map[string]interface{}, 0)
+	err := utils.ReadRecords("users.ndjson", strings.NewReader(data), func(line int, record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadRecords ndjson error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ReadRecords ndjson want 2 records, got %d", len(records))
+	}
+	if n, ok := records[1]["id"].(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Errorf("ReadRecords ndjson should keep big number, got %#v", records[1]["id"])
+	}
+	if records[1]["name"] != nil {
+		t.Errorf("ReadRecords ndjson null should be nil, got %#v", records[1]["name"])
+	}
+
+	if err = utils.ReadRecords("users.txt", strings.NewReader(data), nil); err == nil {
+		t.Errorf("ReadRecords txt should be not supported")
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/sirupsen/logrus"
+)
+
+// audit logger, write json line to audit logfile, not mixed with application log
+var auditLogger = logrus.New()
+
+// logfile is audit log filename such as audit.log, rotate like application log.
+func InitAuditLog(logpath, logfile string, rotate_files, rotate_mbytes uint) error {
+	auditLogger.SetFormatter(&logrus.JSONFormatter{})
+	auditLogger.SetLevel(logrus.InfoLevel)
+
+	if len(logfile) == 0 {
+		auditLogger.SetOutput(os.Stdout)
+		return nil
+	}
+	if len(logpath) == 0 {
+		logpath = "."
+	}
+	if err := CheckMakeDir(logpath); err != nil {
+		logrus.Errorf("create audit log subdir '%s' failed: %s", logpath, err)
+		return err
+	}
+
+	if rotate_files > MAX_ROTATE_LOGFILES {
+		rotate_files = MAX_ROTATE_LOGFILES
+	}
+	if rotate_mbytes > MAX_ROTATE_MBYTES {
+		rotate_mbytes = MAX_ROTATE_MBYTES
+	}
+	logf, err := rotatelogs.New(
+		logpath+"/"+logfile+".%Y%m%d",
+		rotatelogs.WithRotationCount(rotate_files),
+		rotatelogs.WithRotationSize(int64(rotate_mbytes*1024*1024)),
+	)
+	if err != nil {
+		logrus.Errorf("failed to create audit rotatelogs: %s", err)
+		return err
+	}
+	auditLogger.SetOutput(logf)
+
+	return nil
+}
+
+// write one audit record. user is who did it, module such as mysql|redis,
+// action such as insert|update|delete, target such as table or key name.
+func AuditLog(user, ip, module, action, target string, detail interface{}) {
+	auditLogger.WithFields(logrus.Fields{
+		"user":   user,
+		"ip":     ip,
+		"module": module,
+		"action": action,
+		"target": target,
+		"detail": detail,
+	}).Info("audit")
+}
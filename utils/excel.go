@@ -44,10 +44,10 @@ func Json2excel(ch chan string, sheetname, filename string) error {
 			for cols := range len(keys) {
 				// 从A,B,C...开始,当超过26个字母后，从AA,AB,AC...开始，或BA,BB,BC...开始
 				// cols%26 是取余数，cols/26 是取倍数
-				// cell := string('A'+cols%26) + strconv.Itoa(rows+1)
+				// cell := string(rune('A'+cols%26)) + strconv.Itoa(rows+1)
 				cell := fmt.Sprintf("%c%d", 'A'+cols%26, rows+1)
 				if cols/26 > 0 {
-					cell = string('A'+(cols/26-1)) + cell
+					cell = string(rune('A'+(cols/26-1))) + cell
 				}
 				// fmt.Printf("cols: %d:%d %s: %s\n", rows, cols, cell, keys[cols])
 				if err = f.SetCellValue(sheetname, cell, keys[cols]); err != nil {
@@ -67,9 +67,9 @@ func Json2excel(ch chan string, sheetname, filename string) error {
 
 		// 填写数据
 		for cols := range len(keys) {
-			cell := string('A'+cols%26) + strconv.Itoa(rows+1)
+			cell := string(rune('A'+cols%26)) + strconv.Itoa(rows+1)
 			if cols/26 > 0 {
-				cell = string('A'+(cols/26-1)) + cell
+				cell = string(rune('A'+(cols/26-1))) + cell
 			}
 			if err = f.SetCellValue(sheetname, cell, m[keys[cols]]); err != nil {
 				log.Warnf("SetCellValue failed: %v", err)
@@ -110,10 +110,10 @@ func Json2excelWithColumn(ch chan string, columns []string,
 	for cols := range len(columns) {
 		// 从A,B,C...开始,当超过26个字母后，从AA,AB,AC...开始，或BA,BB,BC...开始
 		// cols%26 是取余数，cols/26 是取倍数
-		// cell := string('A'+cols%26) + strconv.Itoa(rows+1)
+		// cell := string(rune('A'+cols%26)) + strconv.Itoa(rows+1)
 		cell := fmt.Sprintf("%c%d", 'A'+cols%26, rows+1)
 		if cols/26 > 0 {
-			cell = string('A'+(cols/26-1)) + cell
+			cell = string(rune('A'+(cols/26-1))) + cell
 		}
 		// fmt.Printf("cols: %d:%d %s: %s\n", rows, cols, cell, keys[cols])
 		if err = f.SetCellValue(sheetname, cell, columns[cols]); err != nil {
@@ -135,9 +135,9 @@ func Json2excelWithColumn(ch chan string, columns []string,
 
 		// 填写数据
 		for cols := range len(columns) {
-			cell := string('A'+cols%26) + strconv.Itoa(rows+1)
+			cell := string(rune('A'+cols%26)) + strconv.Itoa(rows+1)
 			if cols/26 > 0 {
-				cell = string('A'+(cols/26-1)) + cell
+				cell = string(rune('A'+(cols/26-1))) + cell
 			}
 			if err = f.SetCellValue(sheetname, cell, m[columns[cols]]); err != nil {
 				log.Warnf("SetCellValue failed: %v", err)
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// read records from .xlsx, .csv or .ndjson file, the inverse of Json2excel.
+// first row of xlsx and csv is header. fn is called with line number of file and
+// record of header->value, value is string of xlsx and csv, or json value of ndjson.
+func ReadRecords(filename string, r io.Reader, fn func(line int, record map[string]interface{}) error) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return readExcelRecords(r, fn)
+	case ".csv":
+		return readCsvRecords(r, fn)
+	case ".ndjson", ".jsonl":
+		return readNdjsonRecords(r, fn)
+	default:
+		return fmt.Errorf("file '%s' not supported, should be .xlsx, .csv or .ndjson", filename)
+	}
+}
+
+// read first sheet of excel by rows iterator
+func readExcelRecords(r io.Reader, fn func(line int, record map[string]interface{}) error) error {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return fmt.Errorf("excel has not any sheet")
+	}
+	rows, err := f.Rows(sheets[0])
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var header []string
+	line := 0
+	for rows.Next() {
+		line++
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			header = trimHeader(cols)
+			continue
+		}
+		if isEmptyRow(cols) {
+			continue
+		}
+		if err = fn(line, makeRecord(header, cols)); err != nil {
+			return err
+		}
+	}
+
+	return rows.Error()
+}
+
+func readCsvRecords(r io.Reader, fn func(line int, record map[string]interface{}) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // allow variable number of fields
+	reader.LazyQuotes = true
+
+	var header []string
+	for {
+		cols, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if header == nil {
+			header = trimHeader(cols)
+			continue
+		}
+		if isEmptyRow(cols) {
+			continue
+		}
+		if err = fn(line, makeRecord(header, cols)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// one json object per line, numbers are kept as json.Number
+func readNdjsonRecords(r io.Reader, fn func(line int, record map[string]interface{}) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // max 16M per line
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		record := make(map[string]interface{})
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&record); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := fn(line, record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// trim spaces and utf8 bom of header
+func trimHeader(cols []string) []string {
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))
+	}
+	return header
+}
+
+func isEmptyRow(cols []string) bool {
+	for _, col := range cols {
+		if strings.TrimSpace(col) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// excel rows omit trailing empty cells, so cols maybe shorter than header
+func makeRecord(header, cols []string) map[string]interface{} {
+	record := make(map[string]interface{}, len(header))
+	for i, name := range header {
+		if name == "" {
+			continue
+		}
+		if i < len(cols) {
+			record[name] = cols[i]
+		} else {
+			record[name] = ""
+		}
+	}
+	return record
+}